@@ -0,0 +1,306 @@
+// Command chinese-reader scores local files against a list of known words,
+// without the web services.
+//
+// Usage:
+//
+//	chinese-reader score [flags] [file ...]
+//	chinese-reader markup [-format html|ansi|markdown|brackets|ruby|ruby-all] [flags] [file ...]
+//	chinese-reader unknown [-n count] [flags] [file ...]
+//
+// Score prints the percentage of known characters in each file, followed
+// by the known and unknown character counts and the file name. Markup
+// writes each file with its known words highlighted. Unknown lists the
+// unknown words across all of the files, most frequent first, with their
+// pinyin and definitions when a lexicon is given.
+//
+// Files may be given as glob patterns such as articles/*.txt. With no
+// files, or with a file named -, text is read from standard input. The
+// known word list is read from data/words.txt unless set with -words.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/billglover/chinese-reader/scanner"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+const usage = `usage: chinese-reader <command> [flags] [file ...]
+
+commands:
+  score    print the readability score of each file
+  markup   write each file with known words highlighted
+  unknown  list the unknown words across all files
+
+Run chinese-reader <command> -h for the flags of a command.
+`
+
+// Run carries out the command in args and returns the exit status. It is
+// separate from main so that it can be tested.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	cmd := args[0]
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	wordsFile := fs.String("words", "data/words.txt", "file holding the list of known words")
+	lexiconFile := fs.String("lexicon", "", "optional CC-CEDICT file used to find word boundaries")
+	segmenter := fs.String("segmenter", "", "segmentation strategy: forward, backward or bidirectional")
+
+	var format *string
+	var limit *int
+	switch cmd {
+	case "score":
+	case "markup":
+		format = fs.String("format", "html", "markup format: html, ansi, markdown, brackets, ruby or ruby-all")
+	case "unknown":
+		limit = fs.Int("n", 0, "maximum number of words to list, or 0 for all")
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "chinese-reader: unknown command %q\n\n%s", cmd, usage)
+		return 2
+	}
+
+	if err := fs.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	r := &reader{stdin: stdin, stdout: stdout}
+	err := r.load(*wordsFile, *lexiconFile, *segmenter)
+	if err == nil {
+		var names []string
+		names, err = inputs(fs.Args())
+		if err == nil {
+			switch cmd {
+			case "score":
+				err = r.score(names)
+			case "markup":
+				err = r.markup(names, *format)
+			case "unknown":
+				err = r.unknown(names, *limit)
+			}
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "chinese-reader: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// reader holds the known word list and scan options shared by each
+// command.
+type reader struct {
+	dict *scanner.Dictionary
+	lex  *scanner.Lexicon
+	opts scanner.Options
+
+	stdin  io.Reader
+	stdout io.Writer
+}
+
+// Load reads the known word list and the optional lexicon, and parses the
+// name of the segmenter.
+func (r *reader) load(wordsFile, lexiconFile, segmenter string) error {
+	seg, err := scanner.ParseSegmenter(segmenter)
+	if err != nil {
+		return err
+	}
+	r.opts.Segmenter = seg
+
+	f, err := os.Open(wordsFile)
+	if err != nil {
+		return fmt.Errorf("unable to read word list: %v", err)
+	}
+	defer f.Close()
+
+	r.dict, err = scanner.NewDictionary(f)
+	if err != nil {
+		return fmt.Errorf("unable to read word list: %v", err)
+	}
+
+	if lexiconFile == "" {
+		return nil
+	}
+
+	lf, err := os.Open(lexiconFile)
+	if err != nil {
+		return fmt.Errorf("unable to read lexicon: %v", err)
+	}
+	defer lf.Close()
+
+	r.lex, err = scanner.LoadCEDICT(lf)
+	if err != nil {
+		return fmt.Errorf("unable to read lexicon: %v", err)
+	}
+	r.opts.Lexicon = r.lex
+	return nil
+}
+
+// Inputs expands any glob patterns in args into file names, keeping the
+// order in which they were given. An empty list reads standard input. It
+// returns an error if a pattern is malformed or matches no files.
+func inputs(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return []string{"-"}, nil
+	}
+
+	var names []string
+	for _, a := range args {
+		if a == "-" {
+			names = append(names, a)
+			continue
+		}
+
+		matches, err := filepath.Glob(a)
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %v", a, err)
+		}
+		if len(matches) == 0 {
+			// a file name holding glob characters is still opened as is
+			if _, err := os.Stat(a); err != nil {
+				return nil, fmt.Errorf("no files match %q", a)
+			}
+			matches = []string{a}
+		}
+		names = append(names, matches...)
+	}
+	return names, nil
+}
+
+// Open opens the named file, or standard input for the name -.
+func (r *reader) open(name string) (io.ReadCloser, error) {
+	if name == "-" {
+		return ioutil.NopCloser(r.stdin), nil
+	}
+	return os.Open(name)
+}
+
+// Scan reads and scans the whole of the named file.
+func (r *reader) scan(name string) (scanner.Result, error) {
+	f, err := r.open(name)
+	if err != nil {
+		return scanner.Result{}, err
+	}
+	defer f.Close()
+
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return scanner.Result{}, fmt.Errorf("unable to read %s: %v", name, err)
+	}
+	return r.dict.ScanWith(string(b), r.opts), nil
+}
+
+// Score prints a line for each file holding its score, its known and
+// unknown character counts and its name, separated by tabs. Files with no
+// characters to score are shown with a score of -.
+func (r *reader) score(names []string) error {
+	for _, name := range names {
+		res, err := r.scan(name)
+		if err != nil {
+			return err
+		}
+
+		score := "-"
+		if res.Scorable() {
+			score = fmt.Sprintf("%d%%", res.Score())
+		}
+		if _, err := fmt.Fprintf(r.stdout, "%s\t%d\t%d\t%s\n", score, res.Known, res.Unknown, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Markup writes each file to standard output with its known words
+// highlighted in the given format. Files are streamed, so large files are
+// not held in memory.
+func (r *reader) markup(names []string, format string) error {
+	rend, err := scanner.MarkupOptions{Format: format}.Renderer(r.lex)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		f, err := r.open(name)
+		if err != nil {
+			return err
+		}
+		_, err = r.dict.Stream(r.stdout, f, rend, r.opts)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("unable to mark up %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// Unknown prints the unknown words across all files, most frequent first,
+// one to a line with the number of times each occurs. When a lexicon is
+// loaded, the pinyin and definitions of each word follow, separated by
+// tabs. At most limit words are listed unless limit is 0.
+func (r *reader) unknown(names []string, limit int) error {
+	if limit < 0 {
+		return errors.New("the number of words to list must not be negative")
+	}
+
+	var all scanner.Result
+	for _, name := range names {
+		res, err := r.scan(name)
+		if err != nil {
+			return err
+		}
+		all.Segments = append(all.Segments, res.Segments...)
+	}
+
+	words := all.UnknownWords()
+	if limit > 0 && len(words) > limit {
+		words = words[:limit]
+	}
+
+	for _, w := range words {
+		line := fmt.Sprintf("%s\t%d", w.Word, w.Count)
+		if r.lex != nil {
+			var pinyin, defs []string
+			for _, e := range r.lex.Lookup(w.Word) {
+				if p := scanner.PinyinMarks(e.Pinyin); !contains(pinyin, p) {
+					pinyin = append(pinyin, p)
+				}
+				defs = append(defs, e.Definitions...)
+			}
+			line += "\t" + strings.Join(pinyin, " / ") + "\t" + strings.Join(defs, "; ")
+		}
+		if _, err := fmt.Fprintln(r.stdout, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	return path
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	words := writeFile(t, dir, "words.txt", "我\n喜欢\n")
+	lexicon := writeFile(t, dir, "cedict.u8", "信用卡 信用卡 [xin4 yong4 ka3] /credit card/\n")
+	writeFile(t, dir, "a.txt", "我喜欢书。")
+	writeFile(t, dir, "b.txt", "我喜欢信用卡。")
+	writeFile(t, dir, "c.txt", "hello")
+
+	tests := []struct {
+		args  []string
+		stdin string
+		code  int
+		out   string
+	}{
+		{[]string{"score", "-words", words, filepath.Join(dir, "*.txt")}, "", 0,
+			"75%\t3\t1\t" + filepath.Join(dir, "a.txt") + "\n" +
+				"50%\t3\t3\t" + filepath.Join(dir, "b.txt") + "\n" +
+				"-\t0\t0\t" + filepath.Join(dir, "c.txt") + "\n" +
+				"100%\t3\t0\t" + filepath.Join(dir, "words.txt") + "\n"},
+		{[]string{"score", "-words", words}, "我书", 0, "50%\t1\t1\t-\n"},
+		{[]string{"markup", "-words", words, "-format", "brackets", "-"}, "我喜欢书", 0, "[我][喜欢]书"},
+		{[]string{"markup", "-words", words, "-format", "ruby"}, "我", 1, ""},
+		{[]string{"unknown", "-words", words}, "书书报", 0, "书\t2\n报\t1\n"},
+		{[]string{"unknown", "-words", words, "-n", "1"}, "书书报", 0, "书\t2\n"},
+		{[]string{"unknown", "-words", words, "-lexicon", lexicon, filepath.Join(dir, "b.txt")}, "", 0, "信用卡\t1\txìn yòng kǎ\tcredit card\n"},
+		{[]string{"score", "-words", words, filepath.Join(dir, "missing*.txt")}, "", 1, ""},
+		{[]string{"score", "-words", filepath.Join(dir, "missing.txt")}, "", 1, ""},
+		{[]string{"read"}, "", 2, ""},
+		{nil, "", 2, ""},
+	}
+
+	for _, tc := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(tc.args, strings.NewReader(tc.stdin), &stdout, &stderr)
+		if code != tc.code {
+			t.Errorf("%v: unexpected exit status: want %d, got %d (%s)", tc.args, tc.code, code, stderr.String())
+		}
+		if stdout.String() != tc.out {
+			t.Errorf("%v: unexpected output: want %q, got %q", tc.args, tc.out, stdout.String())
+		}
+	}
+}
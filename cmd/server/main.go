@@ -0,0 +1,140 @@
+// Command server runs the home, token and words services in a single
+// process, without App Engine. Word lists are kept in files and tokens in a
+// BoltDB file, both under the store directory.
+//
+// Usage:
+//
+//	server [-addr :8080] [-data home/data] [-store store]
+//
+// The listen address defaults to the PORT environment variable when set.
+// The Stripe key is read from the STRIPE_KEY environment variable.
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/billglover/chinese-reader/home"
+	"github.com/billglover/chinese-reader/token"
+	"github.com/billglover/chinese-reader/words"
+)
+
+func main() {
+	addr := ":8080"
+	if port := os.Getenv("PORT"); port != "" {
+		addr = ":" + port
+	}
+
+	flag.StringVar(&addr, "addr", addr, "address to listen on")
+	dataDir := flag.String("data", "home/data", "directory holding the optional lexicon, conversion, frequency and level files")
+	storeDir := flag.String("store", "store", "directory holding word lists and tokens")
+	homeStatic := flag.String("static", "home/static", "directory holding the home page")
+	tokenStatic := flag.String("token-static", "token/static", "directory holding the token purchase page, served under /buy/")
+	flag.Parse()
+
+	wordStore, err := words.NewFileStore(filepath.Join(*storeDir, "words"))
+	if err != nil {
+		log.Fatalf("unable to open word list store: %v", err)
+	}
+
+	tokenStore, err := token.NewBoltStore(filepath.Join(*storeDir, "tokens.db"))
+	if err != nil {
+		log.Fatalf("unable to open token store: %v", err)
+	}
+	defer tokenStore.Close()
+
+	key := os.Getenv("STRIPE_KEY")
+	if key == "" {
+		key = token.StripeKey
+	}
+
+	wordsSrv := words.NewServer(wordStore)
+	tokenSrv := token.NewServer(tokenStore, token.StripeCharger{Key: key})
+	homeSrv := home.NewServer(tokenValidator{tokenStore}, wordsSource{wordStore}, *dataDir)
+	forgetChanged(wordsSrv, homeSrv)
+
+	srv := &http.Server{
+		Addr:         addr,
+		Handler:      newMux(homeSrv, tokenSrv, wordsSrv, *homeStatic, *tokenStatic),
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 60 * time.Second,
+	}
+
+	log.Printf("listening on %s", addr)
+	log.Fatal(srv.ListenAndServe())
+}
+
+// NewMux routes requests to each service by path, in the same way as the
+// dispatch rules of the App Engine application.
+func newMux(homeSrv *home.Server, tokenSrv *token.Server, wordsSrv *words.Server, homeStatic, tokenStatic string) http.Handler {
+	mux := http.NewServeMux()
+
+	api := homeSrv.Router()
+	mux.Handle("/api", api)
+	mux.Handle("/api/", api)
+
+	tok := tokenSrv.Router()
+	mux.Handle("/token", tok)
+	mux.Handle("/token/", tok)
+
+	wr := wordsSrv.Router()
+	mux.Handle("/words", wr)
+	mux.Handle("/words/", wr)
+
+	mux.Handle("/buy/", http.StripPrefix("/buy/", http.FileServer(http.Dir(tokenStatic))))
+	mux.Handle("/", http.FileServer(http.Dir(homeStatic)))
+	return mux
+}
+
+// ForgetChanged drops word lists cached by the home service as soon as the
+// words service changes them.
+func forgetChanged(wordsSrv *words.Server, homeSrv *home.Server) {
+	wordsSrv.Changed = func(ctx context.Context, id string) {
+		homeSrv.ForgetWords(id)
+	}
+}
+
+// tokenValidator uses tokens directly from the token store rather than
+// through the token service.
+type tokenValidator struct {
+	store token.TokenStore
+}
+
+// UseToken implements the home.TokenValidator interface.
+func (v tokenValidator) UseToken(ctx context.Context, id string) (bool, error) {
+	_, err := v.store.Use(ctx, id)
+	switch err {
+	case nil:
+		return true, nil
+	case token.ErrNotFound, token.ErrInvalid:
+		return false, nil
+	}
+	return false, err
+}
+
+// wordsSource reads word lists directly from the word list store rather
+// than through the words service.
+type wordsSource struct {
+	store words.WordListStore
+}
+
+// Words implements the home.WordsSource interface.
+func (s wordsSource) Words(ctx context.Context, id string) (string, error) {
+	rc, err := s.store.Get(ctx, id)
+	if err == words.ErrNotFound || err == words.ErrInvalidID {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	b, err := ioutil.ReadAll(rc)
+	return string(b), err
+}
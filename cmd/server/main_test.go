@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/billglover/chinese-reader/home"
+	"github.com/billglover/chinese-reader/token"
+	"github.com/billglover/chinese-reader/words"
+)
+
+func TestServer(t *testing.T) {
+	tokenStore := token.NewMemoryStore()
+	wordStore := words.NewMemoryStore()
+
+	ctx := context.Background()
+	tokenStore.Put(ctx, token.Token{ID: "abc", Expires: time.Now().Add(time.Hour), Remaining: 2})
+
+	homeSrv := home.NewServer(tokenValidator{tokenStore}, wordsSource{wordStore}, t.TempDir())
+	mux := newMux(homeSrv, token.NewServer(tokenStore, nil), words.NewServer(wordStore), t.TempDir(), t.TempDir())
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	// upload a word list through the words service
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+	mw.WriteField("token", "abc")
+	fw, _ := mw.CreateFormFile("words", "words.txt")
+	fw.Write([]byte("我\n喜欢\n"))
+	mw.Close()
+
+	resp, err := http.Post(ts.URL+"/words", mw.FormDataContentType(), &b)
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("unexpected status: want %d, got %d", http.StatusCreated, resp.StatusCode)
+	}
+
+	// each scan takes a use from the token
+	tests := []struct {
+		token string
+		code  int
+		score int
+	}{
+		{"abc", http.StatusOK, 75},
+		{"xyz", http.StatusUnauthorized, 0},
+		{"abc", http.StatusOK, 75},
+		{"abc", http.StatusUnauthorized, 0},
+	}
+
+	for i, tc := range tests {
+		body := `{"text": "我喜欢书。", "token": "` + tc.token + `"}`
+		resp, err := http.Post(ts.URL+"/api", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("unexpected error returned: %s", err)
+		}
+
+		var res home.Response
+		json.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+
+		if resp.StatusCode != tc.code {
+			t.Errorf("%d: unexpected status: want %d, got %d", i, tc.code, resp.StatusCode)
+		}
+		if res.Score != tc.score {
+			t.Errorf("%d: unexpected score: want %d, got %d", i, tc.score, res.Score)
+		}
+	}
+
+	resp, err = http.Get(ts.URL + "/token/abc")
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusGone {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusGone, resp.StatusCode)
+	}
+}
+
+func TestServerWordListChanged(t *testing.T) {
+	tokenStore := token.NewMemoryStore()
+	wordStore := words.NewMemoryStore()
+
+	ctx := context.Background()
+	tokenStore.Put(ctx, token.Token{ID: "abc", Expires: time.Now().Add(time.Hour), Remaining: 10})
+	wordStore.Put(ctx, "abc", strings.NewReader("我\n"))
+
+	homeSrv := home.NewServer(tokenValidator{tokenStore}, wordsSource{wordStore}, t.TempDir())
+	wordsSrv := words.NewServer(wordStore)
+	forgetChanged(wordsSrv, homeSrv)
+	ts := httptest.NewServer(newMux(homeSrv, token.NewServer(tokenStore, nil), wordsSrv, t.TempDir(), t.TempDir()))
+	defer ts.Close()
+
+	scan := func() int {
+		body := `{"text": "我喜欢书。", "token": "abc"}`
+		resp, err := http.Post(ts.URL+"/api", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("unexpected error returned: %s", err)
+		}
+		defer resp.Body.Close()
+
+		var res home.Response
+		json.NewDecoder(resp.Body).Decode(&res)
+		return res.Score
+	}
+
+	if got := scan(); got != 25 {
+		t.Errorf("unexpected score: want %d, got %d", 25, got)
+	}
+
+	// replacing the list takes effect on the next scan
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+	fw, _ := mw.CreateFormFile("words", "words.txt")
+	fw.Write([]byte("我\n喜欢\n"))
+	mw.Close()
+
+	req, _ := http.NewRequest("PUT", ts.URL+"/words/abc", &b)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("unexpected status: want %d, got %d", http.StatusCreated, resp.StatusCode)
+	}
+
+	if got := scan(); got != 75 {
+		t.Errorf("unexpected score: want %d, got %d", 75, got)
+	}
+}
+
+func TestWordsSourceMissing(t *testing.T) {
+	src := wordsSource{words.NewMemoryStore()}
+	w, err := src.Words(context.Background(), "abc")
+	if err != nil || w != "" {
+		t.Errorf("unexpected word list: want %q, got %q (%v)", "", w, err)
+	}
+}
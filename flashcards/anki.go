@@ -0,0 +1,76 @@
+package flashcards
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// ErrUnsupportedAnki is returned for Anki exports that hold only a
+// compressed collection, as written by recent versions of Anki unless
+// support for older versions is selected when exporting.
+var ErrUnsupportedAnki = errors.New("anki: compressed collections are not supported, export with support for older Anki versions")
+
+// Collections that may be found in an Anki export, newest first. Exports
+// that hold a compressed collection also hold a placeholder legacy
+// collection, so the compressed name is checked before the legacy one.
+var ankiCollections = []string{"collection.anki21", "collection.anki21b", "collection.anki2"}
+
+// ReadAnki reads the notes in an Anki .apkg deck or .colpkg collection.
+// Fields are stripped of HTML and the word, pinyin and definition are
+// guessed from their contents, so that any note type may be imported. It
+// returns an error if the export cannot be read.
+func ReadAnki(r io.ReaderAt, size int64) ([]Card, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	for _, name := range ankiCollections {
+		f, ok := files[name]
+		if !ok {
+			continue
+		}
+		if strings.HasSuffix(name, "b") {
+			return nil, ErrUnsupportedAnki
+		}
+		return readAnkiCollection(f)
+	}
+	return nil, errors.New("anki: no collection found")
+}
+
+func readAnkiCollection(f *zip.File) ([]Card, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := openSQLite(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var cards []Card
+	err = db.rows("notes", func(row map[string]interface{}) error {
+		flds, _ := row["flds"].(string)
+		c := guessCard(strings.Split(flds, "\x1f"))
+		if c.Word != "" {
+			cards = append(cards, c)
+		}
+		return nil
+	})
+	return cards, err
+}
@@ -0,0 +1,84 @@
+package flashcards
+
+import (
+	"io"
+	"strings"
+
+	"github.com/billglover/chinese-reader/scanner"
+)
+
+// deckHeader tells Anki how to import a deck written by WriteDeck. Versions
+// of Anki that do not understand the header skip it as a comment.
+const deckHeader = "#separator:tab\n#html:false\n#columns:Simplified\tPinyin\tDefinition\tContext\n"
+
+// Deck builds a study card for each unknown word in a scan result, most
+// frequent first. The pinyin and definition are taken from lex, which may
+// be nil, and the context is the first sentence in which the word appears.
+func Deck(res scanner.Result, lex *scanner.Lexicon) []Card {
+	sentences := res.Sentences()
+
+	first := map[string]int{}
+	for _, s := range res.Segments {
+		if _, ok := first[s.Text]; !ok && s.Kind == scanner.Unknown {
+			first[s.Text] = s.Start
+		}
+	}
+
+	var cards []Card
+	for _, w := range res.UnknownWords() {
+		c := Card{Word: w.Word}
+
+		if lex != nil {
+			var pinyin, defs []string
+			for _, e := range lex.Lookup(w.Word) {
+				pinyin = appendNew(pinyin, scanner.PinyinMarks(e.Pinyin))
+				defs = append(defs, e.Definitions...)
+			}
+			c.Pinyin = strings.Join(pinyin, " / ")
+			c.Definition = strings.Join(defs, "; ")
+		}
+
+		for _, s := range sentences {
+			if s.Start <= first[w.Word] && first[w.Word] < s.End {
+				c.Context = strings.TrimSpace(s.Text)
+				break
+			}
+		}
+
+		cards = append(cards, c)
+	}
+	return cards
+}
+
+func appendNew(list []string, s string) []string {
+	for _, l := range list {
+		if l == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// WriteDeck writes cards as a tab separated deck that Anki can import, with
+// the word followed by its pinyin, definition and context. Cards without a
+// word and repeated words are skipped.
+func WriteDeck(w io.Writer, cards []Card) error {
+	if _, err := io.WriteString(w, deckHeader); err != nil {
+		return err
+	}
+
+	seen := map[string]bool{}
+	for _, c := range cards {
+		word := column(c.Word)
+		if word == "" || seen[word] {
+			continue
+		}
+		seen[word] = true
+
+		line := strings.Join([]string{word, column(c.Pinyin), column(c.Definition), column(c.Context)}, "\t")
+		if _, err := io.WriteString(w, line+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+// Package flashcards imports vocabulary from the exports of flashcard apps
+// so that it can be used as a known word list.
+package flashcards
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode"
+)
+
+// Card is a single vocabulary item from a flashcard app. Context is an
+// example of the word in use, such as the sentence it was found in.
+type Card struct {
+	Word       string `json:"word"`
+	Pinyin     string `json:"pinyin,omitempty"`
+	Definition string `json:"definition,omitempty"`
+	Context    string `json:"context,omitempty"`
+}
+
+// ErrUnknownFormat is returned by Import when asked for a format it does
+// not recognise.
+var ErrUnknownFormat = errors.New("unknown flashcard format")
+
+// Formats lists the export formats understood by Import.
+var Formats = []string{"anki", "pleco", "skritter"}
+
+// Import reads cards from an export in the named format, one of "anki" for
+// an Anki .apkg or .colpkg file, "pleco" for a Pleco XML or text export or
+// "skritter" for a Skritter CSV export. It returns an error if the format
+// is not recognised or the export cannot be read.
+func Import(format string, r io.Reader) ([]Card, error) {
+	switch strings.ToLower(format) {
+	case "anki":
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return ReadAnki(bytes.NewReader(b), int64(len(b)))
+	case "pleco":
+		return ReadPleco(r)
+	case "skritter":
+		return ReadSkritter(r)
+	}
+	return nil, fmt.Errorf("%v: %q", ErrUnknownFormat, format)
+}
+
+// WriteWordList writes cards as a tab separated known word list, with the
+// word followed by its pinyin and definition. Cards without a word and
+// repeated words are skipped.
+func WriteWordList(w io.Writer, cards []Card) error {
+	seen := map[string]bool{}
+	for _, c := range cards {
+		word := column(c.Word)
+		if word == "" || seen[word] {
+			continue
+		}
+		seen[word] = true
+
+		line := strings.TrimRight(word+"\t"+column(c.Pinyin)+"\t"+column(c.Definition), "\t")
+		if _, err := io.WriteString(w, line+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Column collapses the whitespace in a field so that it fits in a single
+// tab separated column.
+func column(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// StripHTML removes tags, Anki sound references and entities from a field.
+func stripHTML(s string) string {
+	var b strings.Builder
+	tag := false
+	for _, r := range s {
+		switch {
+		case r == '<':
+			tag = true
+		case r == '>' && tag:
+			tag = false
+			b.WriteByte(' ')
+		case !tag:
+			b.WriteRune(r)
+		}
+	}
+	s = b.String()
+
+	for {
+		i := strings.Index(s, "[sound:")
+		if i < 0 {
+			break
+		}
+		j := strings.Index(s[i:], "]")
+		if j < 0 {
+			s = s[:i]
+			break
+		}
+		s = s[:i] + s[i+j+1:]
+	}
+
+	return column(html.UnescapeString(s))
+}
+
+// HanWord returns the first run of Han characters in s, so that a headword
+// such as 学习[學習] or 学习 (學習) gives its simplified form.
+func hanWord(s string) string {
+	start := strings.IndexFunc(s, isHan)
+	if start < 0 {
+		return ""
+	}
+	end := strings.IndexFunc(s[start:], func(r rune) bool { return !isHan(r) })
+	if end < 0 {
+		return s[start:]
+	}
+	return s[start : start+end]
+}
+
+func isHan(r rune) bool {
+	return unicode.Is(unicode.Han, r)
+}
+
+// IsPinyin reports whether s looks like a pinyin reading, written either
+// with tone marks or tone numbers.
+func isPinyin(s string) bool {
+	toned := false
+	letter := false
+	for _, r := range s {
+		switch {
+		case r >= '1' && r <= '5':
+			if !letter {
+				return false
+			}
+			toned = true
+			letter = false
+		case r > unicode.MaxASCII && unicode.Is(unicode.Latin, r):
+			toned = toned || r != 'ü' && r != 'Ü'
+			letter = true
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+			letter = true
+		case r == ' ', r == '\'', r == '·', r == ':', r == '-':
+			letter = r == ':'
+		default:
+			return false
+		}
+	}
+	return toned
+}
+
+// GuessCard builds a card from the fields of a note whose layout is not
+// known. The word is taken from the first field holding Han characters,
+// the pinyin from the first field that looks like pinyin and the
+// definition from the first remaining field without Han characters.
+func guessCard(fields []string) Card {
+	var c Card
+	for _, f := range fields {
+		f = stripHTML(f)
+		switch {
+		case f == "":
+		case strings.IndexFunc(f, isHan) >= 0:
+			if c.Word == "" {
+				c.Word = hanWord(f)
+			}
+		case c.Pinyin == "" && isPinyin(f):
+			c.Pinyin = f
+		case c.Definition == "":
+			c.Definition = f
+		}
+	}
+	return c
+}
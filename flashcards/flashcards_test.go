@@ -0,0 +1,304 @@
+package flashcards
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/billglover/chinese-reader/scanner"
+)
+
+// Fixtures in testdata are written by testdata/make_fixtures.py.
+
+func readAnkiFile(t *testing.T, name string) ([]Card, error) {
+	b, err := ioutil.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	return ReadAnki(bytes.NewReader(b), int64(len(b)))
+}
+
+func TestReadAnki(t *testing.T) {
+	cards, err := readAnkiFile(t, "deck.apkg")
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+
+	want := []Card{
+		{Word: "学习", Pinyin: "xuéxí", Definition: "to study; to learn"},
+		{Word: "老师", Pinyin: "lǎo shī", Definition: "teacher (n.)"},
+		{Word: "朋友", Pinyin: "peng2you5", Definition: "friend"},
+		{Word: "中文", Pinyin: "zhōngwén", Definition: "Definition first"},
+		{Word: "长", Pinyin: "cháng", Definition: strings.TrimSpace(strings.Repeat("long ", 2000))},
+	}
+	if !reflect.DeepEqual(cards, want) {
+		t.Errorf("unexpected cards: want %v, got %v", want, cards)
+	}
+}
+
+func TestReadAnkiCollection(t *testing.T) {
+	cards, err := readAnkiFile(t, "many.colpkg")
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+
+	if len(cards) != 400 {
+		t.Fatalf("unexpected number of cards: want %d, got %d", 400, len(cards))
+	}
+	for i, c := range cards {
+		if want := string(rune(0x4E00 + i)); c.Word != want {
+			t.Fatalf("unexpected word %d: want %s, got %s", i, want, c.Word)
+		}
+	}
+}
+
+func TestReadAnkiUnsupported(t *testing.T) {
+	if _, err := readAnkiFile(t, "new.apkg"); err != ErrUnsupportedAnki {
+		t.Errorf("unexpected error: want %v, got %v", ErrUnsupportedAnki, err)
+	}
+
+	if _, err := ReadAnki(strings.NewReader("not a zip"), 9); err == nil {
+		t.Errorf("expected an error for an invalid export")
+	}
+}
+
+const testPlecoXML = `<?xml version="1.0" encoding="UTF-8"?>
+<plecoflash formatversion="2" creator="Pleco User" generator="Pleco 2.0">
+<categories><category name="HSK"/></categories>
+<cards>
+<card language="chinese" created="1500000000" modified="1500000000">
+<entry>
+<headword charset="tc">學習</headword>
+<headword charset="sc">学习</headword>
+<pron type="hypy" tones="numbers">xue2xi2</pron>
+<defn>verb
+to study; to learn</defn>
+</entry>
+</card>
+<card language="chinese">
+<entry><headword charset="sc">老师</headword></entry>
+</card>
+<card language="chinese">
+<entry><pron>ni3hao3</pron></entry>
+</card>
+</cards>
+</plecoflash>`
+
+const testPlecoText = "\ufeff// HSK\n" +
+	"学习[學習]\txue2xi2\tverb to study; to learn\n" +
+	"\n" +
+	"老师\tlao3shi1\n" +
+	"朋友\n" +
+	"hello\thai\tnot Chinese\n"
+
+func TestReadPleco(t *testing.T) {
+	tests := []struct {
+		name   string
+		export string
+		want   []Card
+	}{
+		{"xml", testPlecoXML, []Card{
+			{Word: "学习", Pinyin: "xue2xi2", Definition: "verb to study; to learn"},
+			{Word: "老师"},
+		}},
+		{"text", testPlecoText, []Card{
+			{Word: "学习", Pinyin: "xue2xi2", Definition: "verb to study; to learn"},
+			{Word: "老师", Pinyin: "lao3shi1"},
+			{Word: "朋友"},
+		}},
+	}
+
+	for _, tc := range tests {
+		cards, err := ReadPleco(strings.NewReader(tc.export))
+		if err != nil {
+			t.Fatalf("%s: unexpected error returned: %s", tc.name, err)
+		}
+		if !reflect.DeepEqual(cards, tc.want) {
+			t.Errorf("%s: unexpected cards: want %v, got %v", tc.name, tc.want, cards)
+		}
+	}
+}
+
+const testSkritter = "Word,Reading,Definition\r\n" +
+	"学习,xuéxí,\"to study, to learn\"\r\n" +
+	"老师,lǎoshī\r\n" +
+	"\"朋友\",péngyou,friend\r\n"
+
+func TestReadSkritter(t *testing.T) {
+	cards, err := ReadSkritter(strings.NewReader(testSkritter))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+
+	want := []Card{
+		{Word: "学习", Pinyin: "xuéxí", Definition: "to study, to learn"},
+		{Word: "老师", Pinyin: "lǎoshī"},
+		{Word: "朋友", Pinyin: "péngyou", Definition: "friend"},
+	}
+	if !reflect.DeepEqual(cards, want) {
+		t.Errorf("unexpected cards: want %v, got %v", want, cards)
+	}
+}
+
+func TestImport(t *testing.T) {
+	cards, err := Import("Skritter", strings.NewReader(testSkritter))
+	if err != nil || len(cards) != 3 {
+		t.Errorf("unexpected import: want %d cards, got %d (%v)", 3, len(cards), err)
+	}
+
+	if _, err := Import("mnemosyne", strings.NewReader("")); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
+
+func TestWriteWordList(t *testing.T) {
+	cards := []Card{
+		{Word: "学习", Pinyin: "xuéxí", Definition: "to study;\tto learn\n"},
+		{Word: "老师"},
+		{Word: "朋友", Definition: "friend"},
+		{Word: "学习", Pinyin: "xue2xi2"},
+		{Pinyin: "nǐ hǎo"},
+	}
+
+	var b bytes.Buffer
+	if err := WriteWordList(&b, cards); err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+
+	want := "学习\txuéxí\tto study; to learn\n老师\n朋友\t\tfriend\n"
+	if got := b.String(); got != want {
+		t.Errorf("unexpected word list: want %q, got %q", want, got)
+	}
+}
+
+func TestIsPinyin(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"xuéxí", true},
+		{"xue2xi2", true},
+		{"lǎo shī", true},
+		{"nü3", true},
+		{"friend", false},
+		{"page 2", false},
+		{"to study; to learn", false},
+		{"lü", false},
+		{"学习", false},
+	}
+
+	for _, tc := range tests {
+		if got := isPinyin(tc.s); got != tc.want {
+			t.Errorf("%q: want %v, got %v", tc.s, tc.want, got)
+		}
+	}
+}
+
+func TestVarint(t *testing.T) {
+	tests := []struct {
+		b    []byte
+		v    int64
+		size int
+	}{
+		{[]byte{0x00}, 0, 1},
+		{[]byte{0x7f}, 127, 1},
+		{[]byte{0x81, 0x00}, 128, 2},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, -1, 9},
+		{[]byte{0x81}, 0, 0},
+	}
+
+	for _, tc := range tests {
+		v, n := varint(tc.b)
+		if v != tc.v || n != tc.size {
+			t.Errorf("%x: want %d (%d bytes), got %d (%d bytes)", tc.b, tc.v, tc.size, v, n)
+		}
+	}
+}
+
+func FuzzReadAnki(f *testing.F) {
+	for _, name := range []string{"deck.apkg", "many.colpkg"} {
+		b, err := ioutil.ReadFile("testdata/" + name)
+		if err != nil {
+			f.Fatalf("unexpected error returned: %s", err)
+		}
+		f.Add(b)
+	}
+
+	// malformed exports must return an error rather than panic
+	f.Fuzz(func(t *testing.T, b []byte) {
+		ReadAnki(bytes.NewReader(b), int64(len(b)))
+	})
+}
+
+func FuzzSQLite(f *testing.F) {
+	b, err := ioutil.ReadFile("testdata/many.colpkg")
+	if err != nil {
+		f.Fatalf("unexpected error returned: %s", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		f.Fatalf("unexpected error returned: %s", err)
+	}
+	rc, err := zr.File[0].Open()
+	if err != nil {
+		f.Fatalf("unexpected error returned: %s", err)
+	}
+	db, err := ioutil.ReadAll(rc)
+	if err != nil {
+		f.Fatalf("unexpected error returned: %s", err)
+	}
+	f.Add(db)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		db, err := openSQLite(data)
+		if err != nil {
+			return
+		}
+		db.rows("notes", func(map[string]interface{}) error { return nil })
+	})
+}
+
+const testCEDICT = `# CC-CEDICT test extract
+學習 学习 [xue2 xi2] /to learn/to study/
+長 长 [chang2] /long/length/
+長 长 [zhang3] /chief/to grow/
+`
+
+func TestDeck(t *testing.T) {
+	lex, err := scanner.LoadCEDICT(strings.NewReader(testCEDICT))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	d, err := scanner.NewDictionary(strings.NewReader("我\n喜欢"))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+
+	text := "我喜欢学习。\n学习很长，\n很长很长。"
+	res := d.ScanWith(text, scanner.Options{Lexicon: lex})
+
+	want := []Card{
+		{Word: "很", Context: "学习很长，"},
+		{Word: "长", Pinyin: "cháng / zhǎng", Definition: "long; length; chief; to grow", Context: "学习很长，"},
+		{Word: "学习", Pinyin: "xué xí", Definition: "to learn; to study", Context: "我喜欢学习。"},
+	}
+	cards := Deck(res, lex)
+	if !reflect.DeepEqual(cards, want) {
+		t.Errorf("unexpected cards: want %v, got %v", want, cards)
+	}
+
+	var b bytes.Buffer
+	if err := WriteDeck(&b, cards); err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	deck := "#separator:tab\n#html:false\n#columns:Simplified\tPinyin\tDefinition\tContext\n" +
+		"很\t\t\t学习很长，\n" +
+		"长\tcháng / zhǎng\tlong; length; chief; to grow\t学习很长，\n" +
+		"学习\txué xí\tto learn; to study\t我喜欢学习。\n"
+	if got := b.String(); got != deck {
+		t.Errorf("unexpected deck: want %q, got %q", deck, got)
+	}
+}
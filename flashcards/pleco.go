@@ -0,0 +1,94 @@
+package flashcards
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+type plecoExport struct {
+	Cards []struct {
+		Entry struct {
+			Headwords []struct {
+				Charset string `xml:"charset,attr"`
+				Text    string `xml:",chardata"`
+			} `xml:"headword"`
+			Pron string `xml:"pron"`
+			Defn string `xml:"defn"`
+		} `xml:"entry"`
+	} `xml:"cards>card"`
+}
+
+// ReadPleco reads a Pleco flashcard export in either its XML or its text
+// format. Simplified headwords are preferred where both are given. Text
+// exports hold a headword, pinyin and definition separated by tabs, with
+// category lines starting with // skipped. It returns an error if the
+// export cannot be read.
+func ReadPleco(r io.Reader) ([]Card, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+		return readPlecoXML(data)
+	}
+	return readPlecoText(data)
+}
+
+func readPlecoXML(data []byte) ([]Card, error) {
+	var exp plecoExport
+	if err := xml.Unmarshal(data, &exp); err != nil {
+		return nil, err
+	}
+
+	var cards []Card
+	for _, c := range exp.Cards {
+		var word string
+		for _, h := range c.Entry.Headwords {
+			if w := hanWord(h.Text); w != "" && (word == "" || h.Charset == "sc") {
+				word = w
+			}
+		}
+		if word == "" {
+			continue
+		}
+		cards = append(cards, Card{
+			Word:       word,
+			Pinyin:     column(c.Entry.Pron),
+			Definition: column(c.Entry.Defn),
+		})
+	}
+	return cards, nil
+}
+
+func readPlecoText(data []byte) ([]Card, error) {
+	var cards []Card
+
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		word := hanWord(fields[0])
+		if word == "" {
+			continue
+		}
+		c := Card{Word: word}
+		if len(fields) > 1 {
+			c.Pinyin = column(fields[1])
+		}
+		if len(fields) > 2 {
+			c.Definition = column(strings.Join(fields[2:], " "))
+		}
+		cards = append(cards, c)
+	}
+	return cards, s.Err()
+}
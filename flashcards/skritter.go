@@ -0,0 +1,41 @@
+package flashcards
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+// ReadSkritter reads a Skritter CSV export, which holds the word, its
+// reading and its definition in that order. A header row, or any other
+// row without Han characters in the first column, is skipped. It returns
+// an error if the export cannot be read.
+func ReadSkritter(r io.Reader) ([]Card, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	var cards []Card
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		word := hanWord(rec[0])
+		if word == "" {
+			continue
+		}
+		c := Card{Word: word}
+		if len(rec) > 1 {
+			c.Pinyin = column(rec[1])
+		}
+		if len(rec) > 2 {
+			c.Definition = column(rec[2])
+		}
+		cards = append(cards, c)
+	}
+	return cards, nil
+}
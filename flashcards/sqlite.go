@@ -0,0 +1,382 @@
+package flashcards
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// The SQLite reader below understands just enough of the file format to
+// read the rows of a table from a database held in memory. It does not
+// support indexes, WITHOUT ROWID tables, UTF-16 databases or uncommitted
+// WAL files, none of which are needed to read an exported Anki collection.
+// See https://www.sqlite.org/fileformat.html for the format.
+
+var errCorrupt = errors.New("sqlite: malformed database")
+
+const sqliteHeader = "SQLite format 3\x00"
+
+// Page types used by table b-trees.
+const (
+	interiorTablePage = 0x05
+	leafTablePage     = 0x0d
+)
+
+type sqliteDB struct {
+	data     []byte
+	pageSize int
+	usable   int
+}
+
+// OpenSQLite checks the header of a database and returns a reader for it.
+func openSQLite(data []byte) (*sqliteDB, error) {
+	if len(data) < 100 || string(data[:16]) != sqliteHeader {
+		return nil, errors.New("sqlite: not a database")
+	}
+
+	size := int(binary.BigEndian.Uint16(data[16:18]))
+	if size == 1 {
+		size = 65536
+	}
+	if size < 512 || size&(size-1) != 0 {
+		return nil, errCorrupt
+	}
+
+	if enc := binary.BigEndian.Uint32(data[56:60]); enc > 1 {
+		return nil, errors.New("sqlite: unsupported text encoding")
+	}
+
+	usable := size - int(data[20])
+	if usable < 480 {
+		return nil, errCorrupt
+	}
+
+	return &sqliteDB{data: data, pageSize: size, usable: usable}, nil
+}
+
+// Page returns page n, counting from 1. The header of page 1 starts after
+// the 100 byte database header, so hdr gives the offset of the page header.
+func (db *sqliteDB) page(n int) (page []byte, hdr int, err error) {
+	start := (n - 1) * db.pageSize
+	if n < 1 || start+db.pageSize > len(db.data) {
+		return nil, 0, errCorrupt
+	}
+	if n == 1 {
+		hdr = 100
+	}
+	return db.data[start : start+db.usable], hdr, nil
+}
+
+// Table returns the root page and column names of a table.
+func (db *sqliteDB) table(name string) (int, []string, error) {
+	var (
+		root int
+		sql  string
+	)
+	err := db.walk(1, func(rec []interface{}) error {
+		if len(rec) < 5 || rec[0] != "table" || rec[1] != name {
+			return nil
+		}
+		r, ok := rec[3].(int64)
+		if !ok {
+			return errCorrupt
+		}
+		root = int(r)
+		sql, _ = rec[4].(string)
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	if root == 0 {
+		return 0, nil, fmt.Errorf("sqlite: no such table: %s", name)
+	}
+
+	return root, columnNames(sql), nil
+}
+
+// Rows calls fn with every row of a table, keyed by column name. Columns
+// added to a table after a row was written are missing from that row.
+func (db *sqliteDB) rows(name string, fn func(map[string]interface{}) error) error {
+	root, cols, err := db.table(name)
+	if err != nil {
+		return err
+	}
+
+	return db.walk(root, func(rec []interface{}) error {
+		row := make(map[string]interface{}, len(cols))
+		for i, c := range cols {
+			if i < len(rec) {
+				row[c] = rec[i]
+			}
+		}
+		return fn(row)
+	})
+}
+
+// Walk calls fn with the record held in each cell of the table b-tree
+// rooted at page root, in rowid order.
+func (db *sqliteDB) walk(root int, fn func([]interface{}) error) error {
+	seen := map[int]bool{}
+
+	var visit func(n int) error
+	visit = func(n int) error {
+		if seen[n] {
+			return errCorrupt
+		}
+		seen[n] = true
+
+		page, hdr, err := db.page(n)
+		if err != nil {
+			return err
+		}
+		if hdr+8 > len(page) {
+			return errCorrupt
+		}
+
+		kind := page[hdr]
+		cells := int(binary.BigEndian.Uint16(page[hdr+3:]))
+		ptrs := hdr + 8
+		if kind == interiorTablePage {
+			ptrs = hdr + 12
+		}
+		if ptrs+2*cells > len(page) {
+			return errCorrupt
+		}
+
+		for i := 0; i < cells; i++ {
+			off := int(binary.BigEndian.Uint16(page[ptrs+2*i:]))
+			if off >= len(page) {
+				return errCorrupt
+			}
+
+			switch kind {
+			case interiorTablePage:
+				if off+4 > len(page) {
+					return errCorrupt
+				}
+				if err := visit(int(binary.BigEndian.Uint32(page[off:]))); err != nil {
+					return err
+				}
+			case leafTablePage:
+				payload, err := db.payload(page, off)
+				if err != nil {
+					return err
+				}
+				rec, err := decodeRecord(payload)
+				if err != nil {
+					return err
+				}
+				if err := fn(rec); err != nil {
+					return err
+				}
+			default:
+				return errCorrupt
+			}
+		}
+
+		if kind == interiorTablePage {
+			return visit(int(binary.BigEndian.Uint32(page[hdr+8:])))
+		}
+		return nil
+	}
+
+	return visit(root)
+}
+
+// Payload returns the record held in the leaf cell at off, following any
+// overflow pages.
+func (db *sqliteDB) payload(page []byte, off int) ([]byte, error) {
+	size, n := varint(page[off:])
+	if n == 0 || size < 0 || size > int64(len(db.data)) {
+		return nil, errCorrupt
+	}
+	off += n
+	if _, n = varint(page[off:]); n == 0 {
+		return nil, errCorrupt
+	}
+	off += n
+
+	p := int(size)
+	local := db.localSize(p)
+	if off+local > len(page) {
+		return nil, errCorrupt
+	}
+	if local == p {
+		return page[off : off+p], nil
+	}
+
+	out := make([]byte, 0, p)
+	out = append(out, page[off:off+local]...)
+	if off+local+4 > len(page) {
+		return nil, errCorrupt
+	}
+	next := int(binary.BigEndian.Uint32(page[off+local:]))
+
+	for len(out) < p {
+		if next == 0 {
+			return nil, errCorrupt
+		}
+		ovf, _, err := db.page(next)
+		if err != nil {
+			return nil, err
+		}
+		next = int(binary.BigEndian.Uint32(ovf))
+		chunk := ovf[4:]
+		if rest := p - len(out); len(chunk) > rest {
+			chunk = chunk[:rest]
+		}
+		out = append(out, chunk...)
+	}
+	return out, nil
+}
+
+// LocalSize returns how much of a payload of p bytes is stored in a table
+// leaf cell, the rest being spilled to overflow pages.
+func (db *sqliteDB) localSize(p int) int {
+	x := db.usable - 35
+	if p <= x {
+		return p
+	}
+	m := (db.usable-12)*32/255 - 23
+	k := m + (p-m)%(db.usable-4)
+	if k <= x {
+		return k
+	}
+	return m
+}
+
+// DecodeRecord returns the values in a record. Integers are returned as
+// int64, floats as float64, text as string and blobs as []byte.
+func decodeRecord(b []byte) ([]interface{}, error) {
+	hs, n := varint(b)
+	if n == 0 || hs < int64(n) || hs > int64(len(b)) {
+		return nil, errCorrupt
+	}
+
+	hdr, body := b[n:hs], b[hs:]
+	var rec []interface{}
+	for len(hdr) > 0 {
+		t, n := varint(hdr)
+		if n == 0 || t < 0 {
+			return nil, errCorrupt
+		}
+		hdr = hdr[n:]
+
+		size := serialSize(t)
+		if size < 0 || size > int64(len(body)) {
+			return nil, errCorrupt
+		}
+		v := body[:size]
+		body = body[size:]
+
+		switch {
+		case t == 0:
+			rec = append(rec, nil)
+		case t >= 1 && t <= 6:
+			rec = append(rec, bigEndianInt(v))
+		case t == 7:
+			rec = append(rec, math.Float64frombits(binary.BigEndian.Uint64(v)))
+		case t == 8 || t == 9:
+			rec = append(rec, t-8)
+		case t >= 12 && t%2 == 0:
+			rec = append(rec, v)
+		case t >= 13:
+			rec = append(rec, string(v))
+		default:
+			return nil, errCorrupt
+		}
+	}
+	return rec, nil
+}
+
+// SerialSize returns the number of bytes used by a value of serial type t.
+func serialSize(t int64) int64 {
+	switch {
+	case t >= 12:
+		return (t - 12) / 2
+	case t >= 1 && t <= 4:
+		return t
+	case t == 5:
+		return 6
+	case t == 6 || t == 7:
+		return 8
+	case t == 0 || t == 8 || t == 9:
+		return 0
+	}
+	return -1
+}
+
+// BigEndianInt decodes a big-endian two's complement integer.
+func bigEndianInt(b []byte) int64 {
+	var v int64
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		v = -1
+	}
+	for _, c := range b {
+		v = v<<8 | int64(c)
+	}
+	return v
+}
+
+// Varint decodes a SQLite variable length integer, returning the value and
+// the number of bytes read, or 0 bytes if b is too short.
+func varint(b []byte) (int64, int) {
+	var v uint64
+	for i := 0; i < 9; i++ {
+		if i >= len(b) {
+			return 0, 0
+		}
+		if i == 8 {
+			return int64(v<<8 | uint64(b[i])), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return int64(v), i + 1
+		}
+	}
+	return 0, 0
+}
+
+// ColumnNames returns the names of the columns in a CREATE TABLE statement.
+func columnNames(sql string) []string {
+	start, end := strings.Index(sql, "("), strings.LastIndex(sql, ")")
+	if start < 0 || end < start {
+		return nil
+	}
+
+	var (
+		cols  []string
+		depth int
+		last  = start + 1
+	)
+	add := func(def string) {
+		f := strings.Fields(def)
+		if len(f) == 0 {
+			return
+		}
+		switch strings.ToUpper(f[0]) {
+		case "CONSTRAINT", "PRIMARY", "UNIQUE", "CHECK", "FOREIGN":
+			return
+		}
+		cols = append(cols, strings.Trim(f[0], "\"`[]"))
+	}
+
+	for i := start + 1; i < end; i++ {
+		switch sql[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				add(sql[last:i])
+				last = i + 1
+			}
+		}
+	}
+	add(sql[last:end])
+	return cols
+}
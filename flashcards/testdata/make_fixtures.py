@@ -0,0 +1,70 @@
+#!/usr/bin/env python3
+"""Generates the Anki fixtures used by the flashcards tests.
+
+Run from this directory with python3 make_fixtures.py.
+"""
+
+import os
+import sqlite3
+import tempfile
+import zipfile
+
+NOTES_SQL = """CREATE TABLE notes (
+    id              integer primary key,
+    guid            text not null,
+    mid             integer not null,
+    mod             integer not null,
+    usn             integer not null,
+    tags            text not null,
+    flds            text not null,
+    sfld            integer not null,
+    csum            integer not null,
+    flags           integer not null,
+    data            text not null
+)"""
+
+NOTES = [
+    ["学习", "xuéxí", "to study; to learn"],
+    ["<div>老师</div>", "lǎo shī", "teacher&nbsp;<b>(n.)</b>"],
+    ["[sound:pengyou.mp3]朋友 (朋友)", "peng2you5", "friend"],
+    ["", "", "empty note"],
+    ["Definition first", "中文", "zhōngwén"],
+    ["长", "cháng", "long " * 2000],
+]
+
+
+def collection(path, notes, page_size=4096):
+    db = sqlite3.connect(path)
+    db.execute("PRAGMA page_size = %d" % page_size)
+    db.execute(NOTES_SQL)
+    db.execute("CREATE TABLE col (id integer primary key, models text not null)")
+    db.execute("INSERT INTO col VALUES (1, '{}')")
+    for i, fields in enumerate(notes):
+        flds = "\x1f".join(fields)
+        db.execute(
+            "INSERT INTO notes VALUES (?, ?, 1, 0, 0, '', ?, ?, 0, 0, '')",
+            (1000 + i, "guid%d" % i, flds, fields[0]),
+        )
+    db.commit()
+    db.close()
+
+
+def package(name, collections):
+    with zipfile.ZipFile(name, "w", zipfile.ZIP_DEFLATED) as zf:
+        for entry, notes, page_size in collections:
+            with tempfile.TemporaryDirectory() as tmp:
+                path = os.path.join(tmp, "collection")
+                collection(path, notes, page_size)
+                zf.write(path, entry)
+        zf.writestr("media", "{}")
+
+
+# many small pages so that the notes table needs interior pages
+many = [[chr(0x4E00 + i), "yi%d" % (i % 5 + 1), "word %d" % i] for i in range(400)]
+
+package("deck.apkg", [("collection.anki2", NOTES, 4096)])
+package("many.colpkg", [("collection.anki21", many, 512)])
+package("new.apkg", [
+    ("collection.anki2", [["Please update to the latest Anki version"]], 4096),
+    ("collection.anki21b", [], 4096),
+])
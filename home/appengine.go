@@ -0,0 +1,109 @@
+//go:build appengine
+// +build appengine
+
+package home
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/billglover/chinese-reader/internal/logging"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/log"
+	"google.golang.org/appengine/urlfetch"
+)
+
+func init() {
+	s := &Server{
+		Tokens:  services{},
+		Words:   services{},
+		DataDir: "data",
+		Context: appengine.NewContext,
+		Logger:  logging.AppEngine{},
+	}
+	r := s.Router()
+	http.Handle("/api", r)
+	http.Handle("/api/", r)
+}
+
+// services calls the token and words services of the App Engine
+// application over HTTP.
+type services struct{}
+
+// ServiceURL returns the base URL of another service in the application.
+func (services) serviceURL(ctx context.Context, svcName string) (string, error) {
+	host, err := appengine.ModuleHostname(ctx, svcName, "", "")
+	if err != nil {
+		return "", fmt.Errorf("unable to find service %s", svcName)
+	}
+
+	scheme := "https"
+	if appengine.IsDevAppServer() {
+		scheme = "http"
+	}
+	return scheme + "://" + host, nil
+}
+
+// UseToken implements the TokenValidator interface.
+func (svc services) UseToken(ctx context.Context, token string) (bool, error) {
+	tokenURL, err := svc.serviceURL(ctx, "token")
+	if err != nil {
+		return false, err
+	}
+
+	req, _ := http.NewRequest("PATCH", tokenURL+"/token/"+token+"?action=use", nil)
+
+	client := urlfetch.Client(ctx)
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("unable to query internal service")
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, fmt.Errorf("unable to read response from internal service")
+	}
+
+	log.Infof(ctx, string(body))
+
+	if resp.StatusCode != http.StatusOK {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Words implements the WordsSource interface.
+func (svc services) Words(ctx context.Context, token string) (string, error) {
+	wordsURL, err := svc.serviceURL(ctx, "words")
+	if err != nil {
+		return "", err
+	}
+
+	req, _ := http.NewRequest("GET", wordsURL+"/words/"+token, nil)
+
+	client := urlfetch.Client(ctx)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unable to query internal service")
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", nil
+	default:
+		return "", fmt.Errorf("unexpected response from internal service: %s", resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("unable to read response from internal service")
+	}
+
+	return string(body), nil
+}
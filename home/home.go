@@ -3,70 +3,194 @@ package home
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
-
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/billglover/chinese-reader/flashcards"
+	"github.com/billglover/chinese-reader/internal/logging"
 	"github.com/billglover/chinese-reader/scanner"
-	"google.golang.org/appengine"
-	"google.golang.org/appengine/log"
-	"google.golang.org/appengine/urlfetch"
 )
 
 type Request struct {
-	Text  string `json:"text"`
-	Token string `json:"token"`
+	Text      string                 `json:"text"`
+	Token     string                 `json:"token"`
+	Markup    scanner.MarkupOptions  `json:"markup"`
+	Segmenter scanner.Segmenter      `json:"segmenter"`
+	Normalise bool                   `json:"normalise"`
+	Scoring   scanner.ScoringOptions `json:"scoring"`
+	Policy    scanner.Policy         `json:"policy"`
 }
 
 type Response struct {
-	Text   string `json:"string"`
-	Score  int    `json:"readability"`
-	Markup string `json:"markup"`
+	Text     string                  `json:"string"`
+	Score    int                     `json:"readability"`
+	Markup   string                  `json:"markup"`
+	Unknown  []scanner.WordCount     `json:"unknown"`
+	Glossary []scanner.GlossaryEntry `json:"glossary,omitempty"`
+
+	Sentences  []scanner.Passage `json:"sentences"`
+	Paragraphs []scanner.Passage `json:"paragraphs"`
+
+	Model       string             `json:"model"`
+	ModelParams map[string]float64 `json:"model_params"`
+}
+
+// TokenValidator checks that a user token is valid and takes one use from
+// it. It returns false for a token that is unknown, expired or used up.
+type TokenValidator interface {
+	UseToken(ctx context.Context, token string) (bool, error)
+}
+
+// WordsSource returns the known word list for a user token. A user who has
+// not uploaded a list has no known words.
+type WordsSource interface {
+	Words(ctx context.Context, token string) (string, error)
+}
+
+// Server handles requests to the home service. Tokens are checked with
+// Tokens and word lists fetched from Words. Optional data files are read
+// from DataDir. Context returns the context for a request and Logger
+// records what the server is doing.
+type Server struct {
+	Tokens  TokenValidator
+	Words   WordsSource
+	DataDir string
+	Context func(*http.Request) context.Context
+	Logger  logging.Logger
+
+	// word lists parsed for recent requests, by token
+	dictMu  sync.Mutex
+	dicts   map[string]cachedDictionary
+	dictGen int
+
+	// optional data, loaded on first use
+	lexiconOnce     sync.Once
+	lexicon         *scanner.Lexicon
+	converterOnce   sync.Once
+	converter       *scanner.Converter
+	frequenciesOnce sync.Once
+	frequencies     *scanner.Frequencies
+	levelsOnce      sync.Once
+	levels          *scanner.Levels
+}
+
+// NewServer returns a Server that checks tokens with tokens, fetches word
+// lists from words and reads optional data files from dataDir, using the
+// request context and the standard library logger.
+func NewServer(tokens TokenValidator, words WordsSource, dataDir string) *Server {
+	return &Server{
+		Tokens:  tokens,
+		Words:   words,
+		DataDir: dataDir,
+		Context: (*http.Request).Context,
+		Logger:  logging.Std,
+	}
+}
+
+// Router returns a handler that routes requests to the home service API.
+func (s *Server) Router() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api", s.handleRequest)
+	mux.HandleFunc("/api/level", s.handleLevelRequest)
+	mux.HandleFunc("/api/deck", s.handleDeckRequest)
+	return mux
 }
 
-func handleRequest(rw http.ResponseWriter, r *http.Request) {
-	ctx := appengine.NewContext(r)
+func (s *Server) handleRequest(rw http.ResponseWriter, r *http.Request) {
+	ctx := s.Context(r)
 
-	log.Infof(ctx, "/api request received")
+	s.Logger.Infof(ctx, "/api request received")
 
-	// TODO:
-	// - validate user token
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
 	}
 	defer r.Body.Close()
 
 	var mreq Request
 	err = json.Unmarshal(body, &mreq)
 	if err != nil {
-		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// reject texts that cannot be scored before using up the token
+	if !mreq.Policy.Scorable(mreq.Text) {
+		http.Error(rw, scanner.ErrNoScorableText.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	lex := s.loadLexicon(ctx)
+	rend, err := mreq.Markup.Renderer(lex)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	valid, err := validateToken(ctx, mreq.Token)
+	scorer, err := mreq.Scoring.Scorer(s.loadFrequencies(ctx))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	valid, err := s.Tokens.UseToken(ctx, mreq.Token)
 	if err != nil {
 		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	if valid == false {
 		http.Error(rw, "invalid token", http.StatusUnauthorized)
+		return
 	}
 
-	// TODO:
-	// - retrieve user's word list
-	words, err := retrieveWordsList(ctx, mreq.Token)
+	dict, err := s.knownDictionary(ctx, mreq.Token)
 	if err != nil {
 		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	// TODO:
-	// - scan the file
-	score, markup, _ := scanner.Scan(mreq.Text, words)
+	var conv *scanner.Converter
+	if mreq.Normalise {
+		conv = s.loadConverter(ctx)
+		if conv == nil {
+			http.Error(rw, "script normalisation is not available", http.StatusNotImplemented)
+			return
+		}
+	}
+
+	res := dict.ScanWith(mreq.Text, scanner.Options{
+		Segmenter: mreq.Segmenter,
+		Lexicon:   lex,
+		Converter: conv,
+		Policy:    mreq.Policy,
+	})
+	score := int(scorer.Score(res))
+	markup, err := res.Markup(rend)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	mresp := Response{
-		Text:   mreq.Text,
-		Score:  score,
-		Markup: markup,
+		Text:     mreq.Text,
+		Score:    score,
+		Markup:   markup,
+		Unknown:  res.UnknownWords(),
+		Glossary: res.Glossary(lex),
+
+		Sentences:  res.Sentences(),
+		Paragraphs: res.Paragraphs(),
+
+		Model:       scorer.Name(),
+		ModelParams: scorer.Params(),
 	}
 
 	header := rw.Header()
@@ -76,72 +200,305 @@ func handleRequest(rw http.ResponseWriter, r *http.Request) {
 	// - return the results
 }
 
-func init() {
-	http.HandleFunc("/api", handleRequest)
+// LevelRequest asks for the graded level of a text.
+type LevelRequest struct {
+	Text      string            `json:"text"`
+	Token     string            `json:"token"`
+	Segmenter scanner.Segmenter `json:"segmenter"`
 }
 
-func validateToken(ctx context.Context, token string) (bool, error) {
+// LevelResponse reports the graded level of a text.
+type LevelResponse struct {
+	Text string `json:"string"`
+	scanner.LevelReport
+}
+
+// HandleLevelRequest estimates the HSK level of a text. Words are found
+// using the graded word list, and the lexicon if available, rather than
+// the user's own word list.
+func (s *Server) handleLevelRequest(rw http.ResponseWriter, r *http.Request) {
+	ctx := s.Context(r)
+
+	s.Logger.Infof(ctx, "/api/level request received")
 
-	svcName := "token"
-	tokenURL, err := appengine.ModuleHostname(ctx, svcName, "", "")
+	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		return false, fmt.Errorf("unable to find service %s", svcName)
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
 	}
+	defer r.Body.Close()
 
-	scheme := "https"
-	if appengine.IsDevAppServer() {
-		scheme = "http"
+	var mreq LevelRequest
+	err = json.Unmarshal(body, &mreq)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	req, _ := http.NewRequest("PATCH", scheme+"://"+tokenURL+"/token/"+token+"?action=use", nil)
+	if !scanner.DefaultPolicy.Scorable(mreq.Text) {
+		http.Error(rw, scanner.ErrNoScorableText.Error(), http.StatusUnprocessableEntity)
+		return
+	}
 
-	client := urlfetch.Client(ctx)
-	resp, err := client.Do(req)
-	if err != nil {
-		return false, fmt.Errorf("unable to query internal service")
+	// without a graded list there is nothing to spend the token on
+	levels := s.loadLevels(ctx)
+	if levels == nil {
+		http.Error(rw, "level estimation is not available: no graded word list in "+levelsFile, http.StatusNotImplemented)
+		return
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
+	valid, err := s.Tokens.UseToken(ctx, mreq.Token)
 	if err != nil {
-		return false, fmt.Errorf("unable to read response from internal service")
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if valid == false {
+		http.Error(rw, "invalid token", http.StatusUnauthorized)
+		return
 	}
 
-	log.Infof(ctx, string(body))
+	res := levels.Dictionary().ScanWith(mreq.Text, scanner.Options{
+		Segmenter: mreq.Segmenter,
+		Lexicon:   s.loadLexicon(ctx),
+	})
 
-	if resp.StatusCode != http.StatusOK {
-		return false, nil
+	mresp := LevelResponse{
+		Text:        mreq.Text,
+		LevelReport: res.Levels(levels),
 	}
 
-	return true, nil
+	header := rw.Header()
+	header.Add("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(mresp)
 }
 
-func retrieveWordsList(ctx context.Context, token string) (string, error) {
+// DeckRequest asks for study cards for the unknown words in a text.
+type DeckRequest struct {
+	Text      string            `json:"text"`
+	Token     string            `json:"token"`
+	Segmenter scanner.Segmenter `json:"segmenter"`
+	Normalise bool              `json:"normalise"`
+	Policy    scanner.Policy    `json:"policy"`
+}
+
+// HandleDeckRequest scans a text against the user's word list and returns
+// its unknown words as a tab separated deck for download and import into
+// Anki.
+func (s *Server) handleDeckRequest(rw http.ResponseWriter, r *http.Request) {
+	ctx := s.Context(r)
+
+	s.Logger.Infof(ctx, "/api/deck request received")
 
-	svcName := "words"
-	wordsURL, err := appengine.ModuleHostname(ctx, svcName, "", "")
+	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		return "", fmt.Errorf("unable to find service %s", svcName)
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
 	}
+	defer r.Body.Close()
 
-	scheme := "https"
-	if appengine.IsDevAppServer() {
-		scheme = "http"
+	var mreq DeckRequest
+	err = json.Unmarshal(body, &mreq)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	req, _ := http.NewRequest("GET", scheme+"://"+wordsURL+"/words/"+token, nil)
+	if !mreq.Policy.Scorable(mreq.Text) {
+		http.Error(rw, scanner.ErrNoScorableText.Error(), http.StatusUnprocessableEntity)
+		return
+	}
 
-	client := urlfetch.Client(ctx)
-	resp, err := client.Do(req)
+	valid, err := s.Tokens.UseToken(ctx, mreq.Token)
 	if err != nil {
-		return "", fmt.Errorf("unable to query internal service")
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
+	if valid == false {
+		http.Error(rw, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	dict, err := s.knownDictionary(ctx, mreq.Token)
 	if err != nil {
-		return "", fmt.Errorf("unable to read response from internal service")
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var conv *scanner.Converter
+	if mreq.Normalise {
+		conv = s.loadConverter(ctx)
+		if conv == nil {
+			http.Error(rw, "script normalisation is not available", http.StatusNotImplemented)
+			return
+		}
 	}
 
-	return string(body), nil
+	lex := s.loadLexicon(ctx)
+	res := dict.ScanWith(mreq.Text, scanner.Options{
+		Segmenter: mreq.Segmenter,
+		Lexicon:   lex,
+		Converter: conv,
+		Policy:    mreq.Policy,
+	})
+
+	header := rw.Header()
+	header.Add("Content-Type", "text/tab-separated-values; charset=utf-8")
+	header.Add("Content-Disposition", `attachment; filename="deck.txt"`)
+	if err := flashcards.WriteDeck(rw, flashcards.Deck(res, lex)); err != nil {
+		// the status has already been sent, so the error can only be logged
+		s.Logger.Errorf(ctx, "unable to write deck: %v", err)
+	}
+}
+
+// dictionaryTTL is how long a parsed word list is reused before it is
+// fetched again from the words service.
+const dictionaryTTL = time.Minute
+
+// clock returns the current time when checking cached word lists. Tests
+// replace it to expire the cache.
+var clock = time.Now
+
+type cachedDictionary struct {
+	dict    *scanner.Dictionary
+	expires time.Time
+}
+
+// KnownDictionary returns the parsed word list for a token. Word lists are
+// cached for dictionaryTTL, or until ForgetWords is called, so that
+// repeated requests do not refetch and reparse the list from the words
+// service.
+func (s *Server) knownDictionary(ctx context.Context, token string) (*scanner.Dictionary, error) {
+	now := clock()
+
+	s.dictMu.Lock()
+	c, ok := s.dicts[token]
+	gen := s.dictGen
+	s.dictMu.Unlock()
+	if ok && now.Before(c.expires) {
+		return c.dict, nil
+	}
+
+	words, err := s.Words.Words(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	dict, err := scanner.NewDictionary(strings.NewReader(words))
+	if err != nil {
+		return nil, err
+	}
+
+	s.dictMu.Lock()
+	defer s.dictMu.Unlock()
+
+	// a list forgotten while it was being fetched may already be stale
+	if gen != s.dictGen {
+		return dict, nil
+	}
+	if s.dicts == nil {
+		s.dicts = map[string]cachedDictionary{}
+	}
+	for t, c := range s.dicts {
+		if now.After(c.expires) {
+			delete(s.dicts, t)
+		}
+	}
+	s.dicts[token] = cachedDictionary{dict: dict, expires: now.Add(dictionaryTTL)}
+	return dict, nil
+}
+
+// ForgetWords drops the cached word list for a token, so that the next
+// request fetches it again. It should be called whenever the list is
+// written or deleted.
+func (s *Server) ForgetWords(token string) {
+	s.dictMu.Lock()
+	delete(s.dicts, token)
+	s.dictGen++
+	s.dictMu.Unlock()
+}
+
+// lexiconFile is the name of an optional CC-CEDICT file in the data
+// directory. When present it is used to find the boundaries of words that
+// are not in the known list.
+const lexiconFile = "cedict_ts.u8"
+
+// LoadLexicon returns the CC-CEDICT lexicon, or nil if none is available.
+// The lexicon is loaded once per instance.
+func (s *Server) loadLexicon(ctx context.Context) *scanner.Lexicon {
+	s.lexiconOnce.Do(func() {
+		s.loadData(ctx, lexiconFile, func(r io.Reader) (err error) {
+			s.lexicon, err = scanner.LoadCEDICT(r)
+			return err
+		})
+	})
+	return s.lexicon
+}
+
+// converterFile is the name of an optional conversion table in the data
+// directory, used to normalise traditional and simplified characters
+// before matching.
+const converterFile = "t2s.txt"
+
+// LoadConverter returns the script conversion table, or nil if none is
+// available. The table is loaded once per instance.
+func (s *Server) loadConverter(ctx context.Context) *scanner.Converter {
+	s.converterOnce.Do(func() {
+		s.loadData(ctx, converterFile, func(r io.Reader) (err error) {
+			s.converter, err = scanner.LoadConverter(r)
+			return err
+		})
+	})
+	return s.converter
+}
+
+// frequenciesFile is the name of an optional word frequency list in the
+// data directory, used by the frequency-weighted scoring model.
+const frequenciesFile = "frequencies.txt"
+
+// LoadFrequencies returns the word frequency list, or nil if none is
+// available. The list is loaded once per instance.
+func (s *Server) loadFrequencies(ctx context.Context) *scanner.Frequencies {
+	s.frequenciesOnce.Do(func() {
+		s.loadData(ctx, frequenciesFile, func(r io.Reader) (err error) {
+			s.frequencies, err = scanner.LoadFrequencies(r)
+			return err
+		})
+	})
+	return s.frequencies
+}
+
+// levelsFile is the name of an optional graded word list in the data
+// directory, such as the HSK vocabulary, used to estimate the level of a
+// text.
+const levelsFile = "hsk.txt"
+
+// LoadLevels returns the graded word list, or nil if none is available.
+// The list is loaded once per instance.
+func (s *Server) loadLevels(ctx context.Context) *scanner.Levels {
+	s.levelsOnce.Do(func() {
+		s.loadData(ctx, levelsFile, func(r io.Reader) (err error) {
+			s.levels, err = scanner.LoadLevels(r)
+			return err
+		})
+	})
+	return s.levels
+}
+
+// LoadData opens a file in the data directory and passes it to load. A
+// missing file is logged as a warning and any other failure as an error,
+// both leaving the data unavailable.
+func (s *Server) loadData(ctx context.Context, name string, load func(io.Reader) error) {
+	path := filepath.Join(s.DataDir, name)
+	f, err := os.Open(path)
+	if err != nil {
+		s.Logger.Warningf(ctx, "data file unavailable: %v", err)
+		return
+	}
+	defer f.Close()
+
+	if err := load(f); err != nil {
+		s.Logger.Errorf(ctx, "unable to load %s: %v", path, err)
+	}
 }
@@ -0,0 +1,277 @@
+package home
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/billglover/chinese-reader/internal/logging"
+	"github.com/billglover/chinese-reader/internal/servicetest"
+)
+
+// testTokens accepts any token in its map and counts the uses taken.
+type testTokens map[string]int
+
+func (tt testTokens) UseToken(ctx context.Context, token string) (bool, error) {
+	if _, ok := tt[token]; !ok {
+		return false, nil
+	}
+	tt[token]++
+	return true, nil
+}
+
+// testWords returns the same word list for every token.
+type testWords string
+
+func (tw testWords) Words(ctx context.Context, token string) (string, error) {
+	return string(tw), nil
+}
+
+// listWords returns the word list held for each token, which a test may
+// replace between requests.
+type listWords map[string]string
+
+func (lw listWords) Words(ctx context.Context, token string) (string, error) {
+	return lw[token], nil
+}
+
+func newTestServer(t *testing.T, words string) (*Server, testTokens) {
+	tokens := testTokens{"abc": 0}
+	s := NewServer(tokens, testWords(words), t.TempDir())
+	s.Logger = logging.Func(t.Logf)
+	return s, tokens
+}
+
+func serve(s *Server, path, body string) *httptest.ResponseRecorder {
+	return servicetest.Serve(s.Router(), httptest.NewRequest("POST", path, strings.NewReader(body)))
+}
+
+func TestHandleRequestMarkupTag(t *testing.T) {
+	s, tokens := newTestServer(t, "我\n喜欢")
+
+	rw := serve(s, "/api", `{"text": "我喜欢书", "token": "abc", "markup": {"tag": "b onclick=alert(1)"}}`)
+	if rw.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusBadRequest, rw.Code)
+	}
+	if tokens["abc"] != 0 {
+		t.Errorf("unexpected token uses: want %d, got %d", 0, tokens["abc"])
+	}
+
+	rw = serve(s, "/api", `{"text": "我喜欢书", "token": "abc", "markup": {"tag": "mark"}}`)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("unexpected status: want %d, got %d", http.StatusOK, rw.Code)
+	}
+
+	var res Response
+	if err := json.Unmarshal(rw.Body.Bytes(), &res); err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	want := `<mark class="text-primary border border-primary">我</mark><mark class="text-primary border border-primary">喜欢</mark>书`
+	if res.Markup != want {
+		t.Errorf("unexpected markup:\n\twant: %q\n\tgot:  %q", want, res.Markup)
+	}
+}
+
+func TestHandleRequestNoScorableText(t *testing.T) {
+	s, tokens := newTestServer(t, "我")
+	s.DataDir = "data"
+
+	for _, path := range []string{"/api", "/api/level", "/api/deck"} {
+		rw := serve(s, path, `{"text": "hello, 123", "token": "abc"}`)
+		if rw.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: unexpected status: want %d, got %d", path, http.StatusUnprocessableEntity, rw.Code)
+		}
+	}
+	if tokens["abc"] != 0 {
+		t.Errorf("unexpected token uses: want %d, got %d", 0, tokens["abc"])
+	}
+}
+
+func TestHandleLevelRequestUnavailable(t *testing.T) {
+	s, tokens := newTestServer(t, "")
+
+	rw := serve(s, "/api/level", `{"text": "我喜欢书", "token": "abc"}`)
+	if rw.Code != http.StatusNotImplemented {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusNotImplemented, rw.Code)
+	}
+	if tokens["abc"] != 0 {
+		t.Errorf("unexpected token uses: want %d, got %d", 0, tokens["abc"])
+	}
+}
+
+func TestHandleLevelRequest(t *testing.T) {
+	s, tokens := newTestServer(t, "")
+	s.DataDir = "data"
+
+	tests := []struct {
+		text     string
+		estimate int
+		above    bool
+	}{
+		{"我是学生。他是老师。", 1, false},
+		{"我们一起去商店买东西。", 2, false},
+		{"这个问题非常简单，我已经解决了。", 3, false},
+	}
+
+	for _, tc := range tests {
+		rw := serve(s, "/api/level", `{"text": "`+tc.text+`", "token": "abc"}`)
+		if rw.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected status: want %d, got %d", tc.text, http.StatusOK, rw.Code)
+		}
+
+		var res LevelResponse
+		if err := json.Unmarshal(rw.Body.Bytes(), &res); err != nil {
+			t.Fatalf("unexpected error returned: %s", err)
+		}
+		if res.Estimate != tc.estimate || res.Above != tc.above {
+			t.Errorf("%s: unexpected estimate: want %d (above %v), got %d (above %v)", tc.text, tc.estimate, tc.above, res.Estimate, res.Above)
+		}
+	}
+	if tokens["abc"] != len(tests) {
+		t.Errorf("unexpected token uses: want %d, got %d", len(tests), tokens["abc"])
+	}
+}
+
+func TestHandleDeckRequest(t *testing.T) {
+	s, tokens := newTestServer(t, "我\n喜欢")
+	cedict := "信用卡 信用卡 [xin4 yong4 ka3] /credit card/\n"
+	if err := ioutil.WriteFile(filepath.Join(s.DataDir, lexiconFile), []byte(cedict), 0644); err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+
+	rw := serve(s, "/api/deck", `{"text": "我喜欢信用卡。我喜欢书。", "token": "abc"}`)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("unexpected status: want %d, got %d", http.StatusOK, rw.Code)
+	}
+	if tokens["abc"] != 1 {
+		t.Errorf("unexpected token uses: want %d, got %d", 1, tokens["abc"])
+	}
+
+	header := rw.Header()
+	if ct := header.Get("Content-Type"); ct != "text/tab-separated-values; charset=utf-8" {
+		t.Errorf("unexpected content type: %q", ct)
+	}
+	if cd := header.Get("Content-Disposition"); cd != `attachment; filename="deck.txt"` {
+		t.Errorf("unexpected content disposition: %q", cd)
+	}
+
+	want := "#separator:tab\n#html:false\n#columns:Simplified\tPinyin\tDefinition\tContext\n" +
+		"信用卡\txìn yòng kǎ\tcredit card\t我喜欢信用卡。\n" +
+		"书\t\t\t我喜欢书。\n"
+	if rw.Body.String() != want {
+		t.Errorf("unexpected deck:\n\twant: %q\n\tgot:  %q", want, rw.Body.String())
+	}
+}
+
+func TestHandleRequestWordListChanged(t *testing.T) {
+	lists := listWords{"abc": "我"}
+	s := NewServer(testTokens{"abc": 0}, lists, t.TempDir())
+	s.Logger = logging.Func(t.Logf)
+
+	start := time.Now()
+	defer func() { clock = time.Now }()
+	clock = func() time.Time { return start }
+
+	score := func() int {
+		rw := serve(s, "/api", `{"text": "我喜欢", "token": "abc"}`)
+		if rw.Code != http.StatusOK {
+			t.Fatalf("unexpected status: want %d, got %d", http.StatusOK, rw.Code)
+		}
+		var res Response
+		if err := json.Unmarshal(rw.Body.Bytes(), &res); err != nil {
+			t.Fatalf("unexpected error returned: %s", err)
+		}
+		return res.Score
+	}
+
+	tests := []struct {
+		desc   string
+		words  string
+		change func()
+		score  int
+	}{
+		{"first request", "我", func() {}, 33},
+		{"cached list", "我\n喜欢", func() {}, 33},
+		{"after ForgetWords", "我\n喜欢", func() { s.ForgetWords("abc") }, 100},
+		{"cached list", "我", func() {}, 100},
+		{"after the TTL", "我", func() { clock = func() time.Time { return start.Add(dictionaryTTL + time.Second) } }, 33},
+	}
+
+	for _, tc := range tests {
+		lists["abc"] = tc.words
+		tc.change()
+		if got := score(); got != tc.score {
+			t.Errorf("%s: unexpected score: want %d, got %d", tc.desc, tc.score, got)
+		}
+	}
+}
+
+func TestHandleRequestScoringModel(t *testing.T) {
+	s, _ := newTestServer(t, "我\n喜欢")
+
+	tests := []struct {
+		scoring string
+		model   string
+		params  map[string]float64
+		score   int
+	}{
+		{`{}`, "rune-coverage", map[string]float64{}, 75},
+		{`{"model": "token-coverage"}`, "token-coverage", map[string]float64{}, 66},
+		{`{"model": "coverage-threshold", "floor": 0}`, "coverage-threshold", map[string]float64{"threshold": 98, "floor": 0}, 68},
+	}
+
+	for _, tc := range tests {
+		rw := serve(s, "/api", `{"text": "我喜欢书", "token": "abc", "scoring": `+tc.scoring+`}`)
+		if rw.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected status: want %d, got %d", tc.scoring, http.StatusOK, rw.Code)
+		}
+
+		var res Response
+		if err := json.Unmarshal(rw.Body.Bytes(), &res); err != nil {
+			t.Fatalf("unexpected error returned: %s", err)
+		}
+		if res.Model != tc.model || !reflect.DeepEqual(res.ModelParams, tc.params) {
+			t.Errorf("%s: unexpected model: want %s %v, got %s %v", tc.scoring, tc.model, tc.params, res.Model, res.ModelParams)
+		}
+		if res.Score != tc.score {
+			t.Errorf("%s: unexpected score: want %d, got %d", tc.scoring, tc.score, res.Score)
+		}
+	}
+
+	rw := serve(s, "/api", `{"text": "我喜欢书", "token": "abc", "scoring": {"model": "coverage-threshold", "threshold": 120}}`)
+	if rw.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusBadRequest, rw.Code)
+	}
+}
+
+func TestHandleRequestLexicon(t *testing.T) {
+	s, _ := newTestServer(t, "我\n们\n有")
+	cedict := "我們 我们 [wo3 men5] /we/us/\n信用卡 信用卡 [xin4 yong4 ka3] /credit card/\n"
+	if err := ioutil.WriteFile(filepath.Join(s.DataDir, lexiconFile), []byte(cedict), 0644); err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+
+	// 我们 is made up of known characters, 信用卡 is reported as one word
+	rw := serve(s, "/api", `{"text": "我们有信用卡", "token": "abc"}`)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("unexpected status: want %d, got %d", http.StatusOK, rw.Code)
+	}
+
+	var res Response
+	if err := json.Unmarshal(rw.Body.Bytes(), &res); err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	if res.Score != 50 {
+		t.Errorf("unexpected score: want %d, got %d", 50, res.Score)
+	}
+	if len(res.Unknown) != 1 || res.Unknown[0].Word != "信用卡" {
+		t.Errorf("unexpected unknown words: %v", res.Unknown)
+	}
+}
@@ -0,0 +1,25 @@
+//go:build appengine
+// +build appengine
+
+package logging
+
+import (
+	"context"
+
+	"google.golang.org/appengine/log"
+)
+
+// AppEngine writes log entries to the App Engine request log.
+type AppEngine struct{}
+
+func (AppEngine) Infof(ctx context.Context, format string, args ...interface{}) {
+	log.Infof(ctx, format, args...)
+}
+
+func (AppEngine) Warningf(ctx context.Context, format string, args ...interface{}) {
+	log.Warningf(ctx, format, args...)
+}
+
+func (AppEngine) Errorf(ctx context.Context, format string, args ...interface{}) {
+	log.Errorf(ctx, format, args...)
+}
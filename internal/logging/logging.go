@@ -0,0 +1,34 @@
+// Package logging provides the request logger shared by the services.
+package logging
+
+import (
+	"context"
+	"log"
+)
+
+// Logger records messages about the handling of a request. The request
+// context is passed along so that log entries can be tied to a request.
+type Logger interface {
+	Infof(ctx context.Context, format string, args ...interface{})
+	Warningf(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+}
+
+// Func adapts a printf style function, such as log.Printf or t.Logf, to a
+// Logger. Each message is prefixed with its severity.
+type Func func(format string, args ...interface{})
+
+func (f Func) Infof(ctx context.Context, format string, args ...interface{}) {
+	f("INFO: "+format, args...)
+}
+
+func (f Func) Warningf(ctx context.Context, format string, args ...interface{}) {
+	f("WARNING: "+format, args...)
+}
+
+func (f Func) Errorf(ctx context.Context, format string, args ...interface{}) {
+	f("ERROR: "+format, args...)
+}
+
+// Std writes log entries using the standard library logger.
+var Std Logger = Func(log.Printf)
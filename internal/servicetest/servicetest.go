@@ -0,0 +1,15 @@
+// Package servicetest provides helpers shared by the tests of the
+// services.
+package servicetest
+
+import (
+	"net/http"
+	"net/http/httptest"
+)
+
+// Serve sends a request to a handler and returns the recorded response.
+func Serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, r)
+	return rw
+}
@@ -3,31 +3,47 @@ package chinese_reader
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"sync"
 
 	// Note: relative import path required for AppEngine
 	"github.com/billglover/chinese-reader/scanner"
 )
 
 type Request struct {
-	Text string `json:"text"`
+	Text      string                 `json:"text"`
+	Markup    scanner.MarkupOptions  `json:"markup"`
+	Segmenter scanner.Segmenter      `json:"segmenter"`
+	Normalise bool                   `json:"normalise"`
+	Scoring   scanner.ScoringOptions `json:"scoring"`
+	Policy    scanner.Policy         `json:"policy"`
 }
 
 type Response struct {
-	Text   string `json:"string"`
-	Score  int    `json:"readability"`
-	Markup string `json:"markup"`
+	Text     string                  `json:"string"`
+	Score    int                     `json:"readability"`
+	Markup   string                  `json:"markup"`
+	Unknown  []scanner.WordCount     `json:"unknown"`
+	Glossary []scanner.GlossaryEntry `json:"glossary,omitempty"`
+
+	Sentences  []scanner.Passage `json:"sentences"`
+	Paragraphs []scanner.Passage `json:"paragraphs"`
+
+	Model       string             `json:"model"`
+	ModelParams map[string]float64 `json:"model_params"`
 }
 
 func handleRequest(rw http.ResponseWriter, req *http.Request) {
-	fmt.Println("hi")
 	body, err := ioutil.ReadAll(req.Body)
 	if err != nil {
 		log.Println(err)
 		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
 	}
 	defer req.Body.Close()
 
@@ -35,16 +51,65 @@ func handleRequest(rw http.ResponseWriter, req *http.Request) {
 	err = json.Unmarshal(body, &mreq)
 	if err != nil {
 		log.Println(err)
-		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	known := GetKnown()
-	score, markup, _ := scanner.Scan(mreq.Text, known)
+	if !mreq.Policy.Scorable(mreq.Text) {
+		http.Error(rw, scanner.ErrNoScorableText.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	lex := GetLexicon()
+	rend, err := mreq.Markup.Renderer(lex)
+	if err != nil {
+		log.Println(err)
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	scorer, err := mreq.Scoring.Scorer(GetFrequencies())
+	if err != nil {
+		log.Println(err)
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var conv *scanner.Converter
+	if mreq.Normalise {
+		conv = GetConverter()
+		if conv == nil {
+			http.Error(rw, "script normalisation is not available", http.StatusNotImplemented)
+			return
+		}
+	}
+
+	res := GetDictionary().ScanWith(mreq.Text, scanner.Options{
+		Segmenter: mreq.Segmenter,
+		Lexicon:   lex,
+		Converter: conv,
+		Policy:    mreq.Policy,
+	})
+	score := int(scorer.Score(res))
+	markup, err := res.Markup(rend)
+	if err != nil {
+		log.Println(err)
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	mresp := Response{
-		Text:   mreq.Text,
-		Score:  score,
-		Markup: markup,
+		Text:     mreq.Text,
+		Score:    score,
+		Markup:   markup,
+		Unknown:  res.UnknownWords(),
+		Glossary: res.Glossary(lex),
+
+		Sentences:  res.Sentences(),
+		Paragraphs: res.Paragraphs(),
+
+		Model:       scorer.Name(),
+		ModelParams: scorer.Params(),
 	}
 
 	header := rw.Header()
@@ -53,6 +118,100 @@ func handleRequest(rw http.ResponseWriter, req *http.Request) {
 
 }
 
+var (
+	knownOnce sync.Once
+	known     *scanner.Dictionary
+)
+
+// GetDictionary returns the known word list parsed into a dictionary. The
+// list is read and parsed once and reused for all subsequent requests.
+func GetDictionary() *scanner.Dictionary {
+	knownOnce.Do(func() {
+		known, _ = scanner.NewDictionary(strings.NewReader(GetKnown()))
+	})
+	return known
+}
+
+// lexiconPath is the location of an optional CC-CEDICT file. When present
+// it is used to find the boundaries of words that are not in the known list.
+const lexiconPath = "data/cedict_ts.u8"
+
+var (
+	lexiconOnce sync.Once
+	lexicon     *scanner.Lexicon
+)
+
+// GetLexicon returns the CC-CEDICT lexicon, or nil if none is available.
+// The lexicon is loaded once and reused for all subsequent requests.
+func GetLexicon() *scanner.Lexicon {
+	lexiconOnce.Do(func() {
+		loadData(lexiconPath, func(r io.Reader) (err error) {
+			lexicon, err = scanner.LoadCEDICT(r)
+			return err
+		})
+	})
+	return lexicon
+}
+
+// converterPath is the location of an optional conversion table used to
+// normalise traditional and simplified characters before matching.
+const converterPath = "data/t2s.txt"
+
+var (
+	converterOnce sync.Once
+	converter     *scanner.Converter
+)
+
+// GetConverter returns the script conversion table, or nil if none is
+// available. The table is loaded once and reused for all subsequent
+// requests.
+func GetConverter() *scanner.Converter {
+	converterOnce.Do(func() {
+		loadData(converterPath, func(r io.Reader) (err error) {
+			converter, err = scanner.LoadConverter(r)
+			return err
+		})
+	})
+	return converter
+}
+
+// frequenciesPath is the location of an optional word frequency list used
+// by the frequency-weighted scoring model.
+const frequenciesPath = "data/frequencies.txt"
+
+var (
+	frequenciesOnce sync.Once
+	frequencies     *scanner.Frequencies
+)
+
+// GetFrequencies returns the word frequency list, or nil if none is
+// available. The list is loaded once and reused for all subsequent
+// requests.
+func GetFrequencies() *scanner.Frequencies {
+	frequenciesOnce.Do(func() {
+		loadData(frequenciesPath, func(r io.Reader) (err error) {
+			frequencies, err = scanner.LoadFrequencies(r)
+			return err
+		})
+	})
+	return frequencies
+}
+
+// loadData opens a file and passes it to load. Errors are printed and
+// leave the data unavailable.
+func loadData(path string, load func(io.Reader) error) {
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer f.Close()
+
+	if err := load(f); err != nil {
+		fmt.Println(err)
+	}
+}
+
 func GetKnown() string {
 	f, err := os.Open("data/words.txt")
 	if err != nil {
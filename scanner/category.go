@@ -0,0 +1,198 @@
+package scanner
+
+import (
+	"fmt"
+	"unicode"
+)
+
+// Category classifies a rune for scoring.
+type Category int
+
+const (
+	// Han characters.
+	Han Category = iota
+
+	// Latin letters, including accented letters.
+	Latin
+
+	// Digits other than full-width digits.
+	Digit
+
+	// FullWidth letters and digits, such as Ａ and ３.
+	FullWidth
+
+	// Punctuation, including full-width and CJK punctuation.
+	Punctuation
+
+	// Emoji and pictographic symbols.
+	Emoji
+
+	// Other runes, such as whitespace and other scripts.
+	Other
+)
+
+var categoryNames = map[Category]string{
+	Han:         "han",
+	Latin:       "latin",
+	Digit:       "digit",
+	FullWidth:   "full-width",
+	Punctuation: "punctuation",
+	Emoji:       "emoji",
+	Other:       "other",
+}
+
+// String returns the name of the category.
+func (c Category) String() string {
+	if n, ok := categoryNames[c]; ok {
+		return n
+	}
+	return "invalid"
+}
+
+// MarshalText allows a Category to be encoded by name.
+func (c Category) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText allows a Category to be decoded by name.
+func (c *Category) UnmarshalText(b []byte) error {
+	for k, n := range categoryNames {
+		if n == string(b) {
+			*c = k
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown rune category: %q", string(b))
+}
+
+// emoji covers the main emoji and pictograph blocks.
+var emoji = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x2600, Hi: 0x27bf, Stride: 1},
+		{Lo: 0x2b00, Hi: 0x2bff, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1f000, Hi: 0x1faff, Stride: 1},
+	},
+}
+
+// Classify returns the category of a rune.
+func Classify(r rune) Category {
+	switch {
+	case unicode.Is(unicode.Han, r):
+		return Han
+	case (r >= '０' && r <= '９') || (r >= 'Ａ' && r <= 'Ｚ') || (r >= 'ａ' && r <= 'ｚ'):
+		return FullWidth
+	case unicode.Is(unicode.Latin, r):
+		return Latin
+	case unicode.IsDigit(r):
+		return Digit
+	case unicode.Is(emoji, r):
+		return Emoji
+	case unicode.IsPunct(r):
+		return Punctuation
+	}
+	return Other
+}
+
+// Treatment says how runes of a category count towards the score.
+type Treatment int
+
+const (
+	// Ignore leaves runes out of the score altogether.
+	Ignore Treatment = iota
+
+	// Score counts runes as known if they are part of a known word and as
+	// unknown otherwise.
+	Score
+
+	// AlwaysKnown counts runes as known whether or not they are part of a
+	// known word.
+	AlwaysKnown
+)
+
+var treatmentNames = map[Treatment]string{
+	Ignore:      "ignore",
+	Score:       "score",
+	AlwaysKnown: "known",
+}
+
+// String returns the name of the treatment.
+func (t Treatment) String() string {
+	if n, ok := treatmentNames[t]; ok {
+		return n
+	}
+	return "invalid"
+}
+
+// MarshalText allows a Treatment to be encoded by name.
+func (t Treatment) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText allows a Treatment to be decoded by name.
+func (t *Treatment) UnmarshalText(b []byte) error {
+	for k, n := range treatmentNames {
+		if n == string(b) {
+			*t = k
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown treatment: %q", string(b))
+}
+
+// Policy sets the treatment of each category of rune. Categories missing
+// from the policy are ignored.
+type Policy map[Category]Treatment
+
+// DefaultPolicy scores Han characters and ignores everything else.
+var DefaultPolicy = Policy{Han: Score}
+
+// Count returns the number of runes in text that count as known and as
+// unknown under the policy. Known reports whether text is a known word. A
+// nil policy is treated as DefaultPolicy.
+func (p Policy) count(text string, known bool) (int, int) {
+	if p == nil {
+		p = DefaultPolicy
+	}
+
+	k, u := 0, 0
+	for _, r := range text {
+		switch p[Classify(r)] {
+		case Score:
+			if known {
+				k++
+			} else {
+				u++
+			}
+		case AlwaysKnown:
+			k++
+		}
+	}
+	return k, u
+}
+
+// Scorable reports whether any rune in text counts towards the score under
+// the policy. A text that is not scorable has no meaningful score. A nil
+// policy is treated as DefaultPolicy.
+func (p Policy) Scorable(text string) bool {
+	if p == nil {
+		p = DefaultPolicy
+	}
+	for _, r := range text {
+		if p[Classify(r)] != Ignore {
+			return true
+		}
+	}
+	return false
+}
+
+// IsWordRune reports whether r is part of a run of letters or digits that
+// should be kept together as a single word when it is not matched.
+func isWordRune(r rune) bool {
+	switch Classify(r) {
+	case Latin, Digit, FullWidth:
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	}
+	return false
+}
@@ -0,0 +1,230 @@
+package scanner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// LexiconEntry is a single entry from a CC-CEDICT dictionary. Pinyin is
+// kept in the numbered form used by CC-CEDICT, e.g. "xin4 yong4 ka3".
+type LexiconEntry struct {
+	Traditional string   `json:"traditional"`
+	Simplified  string   `json:"simplified"`
+	Pinyin      string   `json:"pinyin"`
+	Definitions []string `json:"definitions"`
+}
+
+// Lexicon is a general dictionary of Chinese words. When passed to a scan
+// it is used to find word boundaries, so that words missing from the known
+// list are still reported as whole units. Entries are indexed by both
+// their traditional and simplified forms.
+type Lexicon struct {
+	entries map[string][]*LexiconEntry
+	words   trie
+	rwords  trie
+	size    int
+
+	// readings holds the default numbered reading of each character
+	readings map[rune]string
+}
+
+// LoadCEDICT reads a dictionary in CC-CEDICT format. Each line holds one
+// entry of the form:
+//
+//	Traditional Simplified [pin1 yin1] /definition 1/definition 2/
+//
+// Blank lines and lines starting with # are ignored. It returns an error
+// if a line is malformed or it fails to read from the reader.
+func LoadCEDICT(r io.Reader) (*Lexicon, error) {
+	l := &Lexicon{entries: map[string][]*LexiconEntry{}}
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	n := 0
+	for s.Scan() {
+		n++
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		e, err := parseCEDICTLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("cedict: line %d: %v", n, err)
+		}
+		l.add(e)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	l.buildReadings()
+	return l, nil
+}
+
+func parseCEDICTLine(line string) (*LexiconEntry, error) {
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("missing headwords")
+	}
+
+	rest := fields[2]
+	if !strings.HasPrefix(rest, "[") {
+		return nil, fmt.Errorf("missing pinyin")
+	}
+	end := strings.Index(rest, "]")
+	if end < 0 {
+		return nil, fmt.Errorf("unterminated pinyin")
+	}
+
+	e := &LexiconEntry{
+		Traditional: fields[0],
+		Simplified:  fields[1],
+		Pinyin:      rest[1:end],
+	}
+
+	defs := strings.TrimSpace(rest[end+1:])
+	if !strings.HasPrefix(defs, "/") {
+		return nil, fmt.Errorf("missing definitions")
+	}
+	for _, d := range strings.Split(strings.Trim(defs, "/"), "/") {
+		if d = strings.TrimSpace(d); d != "" {
+			e.Definitions = append(e.Definitions, d)
+		}
+	}
+
+	return e, nil
+}
+
+func (l *Lexicon) add(e *LexiconEntry) {
+	l.size++
+
+	heads := []string{e.Simplified}
+	if e.Traditional != e.Simplified {
+		heads = append(heads, e.Traditional)
+	}
+
+	for _, h := range heads {
+		if _, ok := l.entries[h]; !ok {
+			l.words.insert([]rune(h))
+			l.rwords.insertReversed([]rune(h))
+		}
+		l.entries[h] = append(l.entries[h], e)
+	}
+}
+
+// Len returns the number of entries in the lexicon.
+func (l *Lexicon) Len() int {
+	return l.size
+}
+
+// Lookup returns all entries whose traditional or simplified form matches
+// word, in the order they appeared in the dictionary.
+func (l *Lexicon) Lookup(word string) []*LexiconEntry {
+	return l.entries[word]
+}
+
+// BuildReadings chooses a default reading for every character in the
+// lexicon. Where a character has more than one reading, the one used by
+// the most words wins, so 行 reads xíng rather than háng. Ties go to the
+// reading that sorts first.
+func (l *Lexicon) buildReadings() {
+	counts := map[rune]map[string]int{}
+	l.readings = map[rune]string{}
+
+	seen := map[*LexiconEntry]bool{}
+	for _, es := range l.entries {
+		for _, e := range es {
+			if seen[e] {
+				continue
+			}
+			seen[e] = true
+
+			heads := []string{e.Simplified}
+			if e.Traditional != e.Simplified {
+				heads = append(heads, e.Traditional)
+			}
+
+			syls := strings.Fields(e.Pinyin)
+			for _, head := range heads {
+				rs := []rune(head)
+				if len(rs) != len(syls) {
+					continue
+				}
+				for i, r := range rs {
+					if counts[r] == nil {
+						counts[r] = map[string]int{}
+					}
+					counts[r][strings.ToLower(syls[i])]++
+				}
+			}
+		}
+	}
+
+	for r, c := range counts {
+		best := 0
+		for syl, n := range c {
+			if n > best || (n == best && syl < l.readings[r]) {
+				best = n
+				l.readings[r] = syl
+			}
+		}
+	}
+}
+
+// Readings returns the pinyin, with tone marks, for each rune of word.
+// The word is read from the start by forward longest match: at each
+// position the longest lexicon word of two or more runes beginning there
+// is read as a whole, if it has a reading with one syllable per rune, so
+// that polyphonic characters are read as they are in that word. Other
+// runes are given the character's most common reading. Runes with no
+// known reading, such as punctuation, are given an empty string.
+func (l *Lexicon) Readings(word string) []string {
+	rs := []rune(word)
+	out := make([]string, len(rs))
+
+	for i := 0; i < len(rs); {
+		if n := l.words.longest(rs[i:]); n > 1 {
+			if syls := l.wordReading(string(rs[i : i+n])); len(syls) == n {
+				for j, syl := range syls {
+					out[i+j] = markSyllable(syl)
+				}
+				i += n
+				continue
+			}
+		}
+
+		if syl, ok := l.readings[rs[i]]; ok {
+			out[i] = markSyllable(syl)
+		}
+		i++
+	}
+
+	return out
+}
+
+// WordReading returns the numbered syllables of the first entry for word
+// that has one syllable per rune. Common words are preferred over proper
+// nouns, which CC-CEDICT writes with capitalised pinyin.
+func (l *Lexicon) wordReading(word string) []string {
+	n := len([]rune(word))
+
+	var proper []string
+	for _, e := range l.entries[word] {
+		syls := strings.Fields(e.Pinyin)
+		if len(syls) != n {
+			continue
+		}
+		if e.Pinyin != strings.ToLower(e.Pinyin) {
+			if proper == nil {
+				proper = syls
+			}
+			continue
+		}
+		return syls
+	}
+	return proper
+}
@@ -0,0 +1,78 @@
+package scanner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Converter normalises Chinese text from one script to another, such as
+// traditional to simplified characters. Phrase conversions take priority
+// over single characters, longest match first. Every conversion maps to
+// the same number of characters, so offsets into converted text are also
+// offsets into the original.
+type Converter struct {
+	from trie
+	to   map[string][]rune
+}
+
+// LoadConverter reads one or more conversion tables. Each line holds the
+// text to convert followed by its replacement, separated by whitespace.
+// Where a line lists several replacements, as OpenCC tables do, the first
+// is used. Blank lines and lines starting with # are ignored, as are
+// conversions that would change the number of characters. It returns an
+// error if a line is malformed or it fails to read from a reader.
+func LoadConverter(rs ...io.Reader) (*Converter, error) {
+	c := &Converter{to: map[string][]rune{}}
+
+	for _, r := range rs {
+		s := bufio.NewScanner(r)
+		n := 0
+		for s.Scan() {
+			n++
+			line := strings.TrimSpace(s.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("conversion table: line %d: missing replacement", n)
+			}
+			if utf8.RuneCountInString(fields[0]) != utf8.RuneCountInString(fields[1]) {
+				continue
+			}
+
+			c.from.insert([]rune(fields[0]))
+			c.to[fields[0]] = []rune(fields[1])
+		}
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Convert returns the text in the target script.
+func (c *Converter) Convert(text string) string {
+	return string(c.convert([]rune(text)))
+}
+
+// Convert returns a converted copy of rs of the same length.
+func (c *Converter) convert(rs []rune) []rune {
+	out := make([]rune, len(rs))
+	for i := 0; i < len(rs); {
+		l := c.from.longest(rs[i:])
+		if l == 0 {
+			out[i] = rs[i]
+			i++
+			continue
+		}
+		copy(out[i:], c.to[string(rs[i:i+l])])
+		i += l
+	}
+	return out
+}
@@ -0,0 +1,164 @@
+package scanner
+
+import (
+	"io"
+	"sync"
+	"unicode"
+)
+
+// Dictionary is a parsed list of known words. It is built once and is not
+// modified afterwards, so a single Dictionary may be used to scan any
+// number of texts from multiple goroutines.
+type Dictionary struct {
+	words  trie
+	rwords trie
+	size   int
+	list   []string
+	meta   *WordList
+
+	// normalised copies of the dictionary, built on first use
+	mu         sync.Mutex
+	normalised map[*Converter]*Dictionary
+}
+
+// Options control how a Dictionary scans text. The zero value gives
+// forward maximum matching over the known list alone. If Lexicon is set,
+// its words are used to find word boundaries while the known list is
+// still used to decide which words are known. A lexicon word made up
+// entirely of known words, such as 我们 with 我 and 们 known, is matched
+// as those known words so that character lists are not penalised. If
+// Converter is set, both the known list and the text are converted before
+// matching, so that a list in one script can be used to read text in
+// another. Segments always hold the original text. Policy sets how each category of rune counts
+// towards the score, and defaults to DefaultPolicy.
+type Options struct {
+	Segmenter Segmenter
+	Lexicon   *Lexicon
+	Converter *Converter
+	Policy    Policy
+}
+
+// NewDictionary reads a list of known words, as described by ParseWordList,
+// and returns a Dictionary ready for scanning. It returns an error if it
+// fails to read from the reader.
+func NewDictionary(r io.Reader) (*Dictionary, error) {
+	l, err := ParseWordList(r)
+	if err != nil {
+		return nil, err
+	}
+	return l.Dictionary(), nil
+}
+
+func newDictionary(list []string) *Dictionary {
+	d := &Dictionary{list: list}
+	for _, w := range list {
+		d.words.insert([]rune(w))
+		d.rwords.insertReversed([]rune(w))
+	}
+	d.size = len(list)
+	return d
+}
+
+// Normalise returns a copy of the dictionary with every word converted by
+// c. Copies are built once per converter and then reused.
+func (d *Dictionary) normalise(c *Converter) *Dictionary {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if nd, ok := d.normalised[c]; ok {
+		return nd
+	}
+
+	list := make([]string, len(d.list))
+	for i, w := range d.list {
+		list[i] = c.Convert(w)
+	}
+	nd := newDictionary(list)
+
+	if d.normalised == nil {
+		d.normalised = map[*Converter]*Dictionary{}
+	}
+	d.normalised[c] = nd
+	return nd
+}
+
+// Len returns the number of words in the dictionary.
+func (d *Dictionary) Len() int {
+	return d.size
+}
+
+// Contains reports whether a word is in the dictionary.
+func (d *Dictionary) Contains(word string) bool {
+	return d.words.contains([]rune(word))
+}
+
+// Metadata returns the columns listed alongside a word in the word list
+// the dictionary was read from, such as pinyin or a meaning, and whether
+// the word is in the dictionary.
+func (d *Dictionary) Metadata(word string) ([]string, bool) {
+	if d.meta == nil {
+		return nil, d.Contains(word)
+	}
+	return d.meta.Lookup(word)
+}
+
+// Scan looks through a string of text and matches words against the
+// dictionary, longest match first. It returns the text broken into known,
+// unknown and non-Han segments along with character counts.
+func (d *Dictionary) Scan(text string) Result {
+	return d.ScanWith(text, Options{})
+}
+
+// ScanWith is Scan using the given options.
+func (d *Dictionary) ScanWith(text string, opts Options) Result {
+	var res Result
+
+	rs := []rune(text)
+	b := newBuilder(text, rs)
+
+	// match against the normalised text, but keep the original runes for
+	// the segments
+	norm := rs
+	if opts.Converter != nil {
+		d = d.normalise(opts.Converter)
+		norm = opts.Converter.convert(rs)
+		b.norm = norm
+	}
+
+	for _, sp := range d.segment(norm, opts.Segmenter, opts.Lexicon) {
+		k, u := opts.Policy.count(string(rs[sp.start:sp.end]), sp.known)
+		res.Known += k
+		res.Unknown += u
+
+		switch {
+		case sp.known:
+			b.add(sp.start, sp.end, Known)
+		case u > 0:
+			b.add(sp.start, sp.end, Unknown)
+		default:
+			b.add(sp.start, sp.end, NonHan)
+		}
+
+		if opts.Lexicon != nil {
+			last := &b.segments[len(b.segments)-1]
+			if last.Start == sp.start {
+				last.Entries = opts.Lexicon.Lookup(string(norm[sp.start:sp.end]))
+			}
+		}
+	}
+
+	res.Segments = b.segments
+	res.policy = opts.Policy
+	return res
+}
+
+// CountHan returns the number of Han runes in rs.
+func countHan(rs []rune) int {
+	n := 0
+	for _, r := range rs {
+		if unicode.Is(unicode.Han, r) {
+			n++
+		}
+	}
+	return n
+}
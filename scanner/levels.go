@@ -0,0 +1,144 @@
+package scanner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// LevelCoverage is the proportion of words in a text that must be at or
+// below a level for the text to be estimated at that level.
+const LevelCoverage = 0.95
+
+// Levels assigns words to graded levels, such as HSK 1 to 6 or the HSK 3.0
+// bands 1 to 7 (with 7 standing for the combined 7 to 9 band).
+type Levels struct {
+	levels map[string]int
+	max    int
+	dict   *Dictionary
+}
+
+// LoadLevels reads a graded word list. Each line holds a word and its
+// level, a positive integer, separated by whitespace. A word listed more
+// than once keeps its lowest level. Blank lines and lines starting with #
+// are ignored. It returns an error if a line is malformed, the list holds
+// no words or it fails to read from the reader.
+func LoadLevels(r io.Reader) (*Levels, error) {
+	l := &Levels{levels: map[string]int{}}
+
+	s := bufio.NewScanner(r)
+	n := 0
+	for s.Scan() {
+		n++
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("levels: line %d: missing level", n)
+		}
+		lv, err := strconv.Atoi(fields[1])
+		if err != nil || lv <= 0 {
+			return nil, fmt.Errorf("levels: line %d: invalid level %q", n, fields[1])
+		}
+
+		if old, ok := l.levels[fields[0]]; !ok || lv < old {
+			l.levels[fields[0]] = lv
+		}
+		if lv > l.max {
+			l.max = lv
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(l.levels) == 0 {
+		return nil, fmt.Errorf("levels: no words")
+	}
+
+	list := make([]string, 0, len(l.levels))
+	for w := range l.levels {
+		list = append(list, w)
+	}
+	l.dict = newDictionary(list)
+
+	return l, nil
+}
+
+// Level returns the level of a word, or 0 if the word is not listed.
+func (l *Levels) Level(word string) int {
+	return l.levels[word]
+}
+
+// Max returns the highest level in the list.
+func (l *Levels) Max() int {
+	return l.max
+}
+
+// Dictionary returns the graded words as a Dictionary, so that text can
+// be segmented by the graded list alone.
+func (l *Levels) Dictionary() *Dictionary {
+	return l.dict
+}
+
+// LevelCount is the number of words in a text at a given level.
+type LevelCount struct {
+	Level int `json:"level"`
+	Count int `json:"count"`
+}
+
+// LevelReport describes the graded level of a text. Distribution counts
+// the words at each level, from level 1 upwards, followed by the words
+// that are not listed at level 0. Estimate is the lowest level that covers
+// LevelCoverage of the words in the text. Above is set if even the highest
+// level falls short, in which case Estimate is the highest level.
+type LevelReport struct {
+	Distribution []LevelCount `json:"distribution"`
+	Estimate     int          `json:"estimate"`
+	Above        bool         `json:"above"`
+	Words        int          `json:"words"`
+}
+
+// Levels classifies every word in the result against the graded list.
+// Segments holding no Han characters are not counted as words.
+func (r Result) Levels(l *Levels) LevelReport {
+	counts := make([]int, l.max+1)
+	words := 0
+	for _, s := range r.Segments {
+		if countHan([]rune(s.Text)) == 0 {
+			continue
+		}
+		word := s.Text
+		if s.Entry != "" {
+			word = s.Entry
+		}
+		counts[l.Level(word)]++
+		words++
+	}
+
+	rep := LevelReport{Words: words, Estimate: l.max}
+	for lv := 1; lv <= l.max; lv++ {
+		rep.Distribution = append(rep.Distribution, LevelCount{Level: lv, Count: counts[lv]})
+	}
+	rep.Distribution = append(rep.Distribution, LevelCount{Level: 0, Count: counts[0]})
+
+	if words == 0 {
+		rep.Estimate = 1
+		return rep
+	}
+
+	covered := 0
+	for lv := 1; lv <= l.max; lv++ {
+		covered += counts[lv]
+		if float64(covered) >= LevelCoverage*float64(words) {
+			rep.Estimate = lv
+			return rep
+		}
+	}
+	rep.Above = true
+	return rep
+}
@@ -0,0 +1,108 @@
+package scanner
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Passage is a sentence or paragraph of scanned text with its own
+// character counts. Offsets are half open and are given both in runes and
+// in bytes into the original text. Coverage is the percentage of runes in
+// the passage scored by the scan policy that count as known.
+type Passage struct {
+	Text      string  `json:"text"`
+	Start     int     `json:"start"`
+	End       int     `json:"end"`
+	ByteStart int     `json:"byte_start"`
+	ByteEnd   int     `json:"byte_end"`
+	Known     int     `json:"known"`
+	Unknown   int     `json:"unknown"`
+	Coverage  float64 `json:"coverage"`
+}
+
+// isSentenceEnd reports whether r ends a sentence. Line breaks also end a
+// sentence so that headings and list items stand alone.
+func isSentenceEnd(r rune) bool {
+	switch r {
+	case '。', '！', '？', '；', '!', '?', ';', '\n':
+		return true
+	}
+	return false
+}
+
+// isParagraphEnd reports whether r ends a paragraph.
+func isParagraphEnd(r rune) bool {
+	return r == '\n'
+}
+
+// isSentenceTrail reports whether r stays with the sentence it follows.
+// This is true of whitespace and of runes that close a quotation or
+// bracket.
+func isSentenceTrail(r rune) bool {
+	switch r {
+	case '”', '’', '」', '』', '）', '》', '〉', '】', '"', '\'', ')':
+		return true
+	}
+	return unicode.IsSpace(r)
+}
+
+// Sentences splits the result into sentences at Chinese sentence ending
+// punctuation (。！？；) and line breaks. Closing quotes and brackets, and
+// any whitespace, after the punctuation stay with the sentence they end.
+func (r Result) Sentences() []Passage {
+	return r.split(isSentenceEnd, isSentenceTrail)
+}
+
+// Paragraphs splits the result into paragraphs at line breaks. Blank lines
+// stay with the paragraph they follow.
+func (r Result) Paragraphs() []Passage {
+	return r.split(isParagraphEnd, unicode.IsSpace)
+}
+
+// Split breaks the result into passages. A passage ends after a rune for
+// which end returns true, once any following runes for which trail returns
+// true have been taken.
+func (r Result) split(end, trail func(rune) bool) []Passage {
+	var ps []Passage
+	var text strings.Builder
+	cur := Passage{}
+	ending := false
+
+	flush := func(start, byteStart int) {
+		cur.Text = text.String()
+		cur.End, cur.ByteEnd = start, byteStart
+		cur.Coverage = percent(float64(cur.Known), float64(cur.Known+cur.Unknown))
+		ps = append(ps, cur)
+
+		text.Reset()
+		cur = Passage{Start: start, ByteStart: byteStart}
+		ending = false
+	}
+
+	// ends are looked for in every segment, as a policy that scores
+	// punctuation puts it in known and unknown segments
+	for _, s := range r.Segments {
+		pos := s.Start
+		for i, c := range s.Text {
+			if ending && !trail(c) {
+				flush(pos, s.ByteStart+i)
+			}
+			_, size := utf8.DecodeRuneInString(s.Text[i:])
+			text.WriteString(s.Text[i : i+size])
+			k, u := r.policy.count(string(c), s.Kind == Known)
+			cur.Known += k
+			cur.Unknown += u
+			if end(c) {
+				ending = true
+			}
+			pos++
+		}
+	}
+
+	if text.Len() > 0 {
+		last := r.Segments[len(r.Segments)-1]
+		flush(last.End, last.ByteEnd)
+	}
+	return ps
+}
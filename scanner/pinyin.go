@@ -0,0 +1,127 @@
+package scanner
+
+import (
+	"strings"
+	"unicode"
+)
+
+// toneMarks maps each pinyin vowel to its forms for tones one to four.
+var toneMarks = map[rune][4]rune{
+	'a': {'ā', 'á', 'ǎ', 'à'},
+	'e': {'ē', 'é', 'ě', 'è'},
+	'i': {'ī', 'í', 'ǐ', 'ì'},
+	'o': {'ō', 'ó', 'ǒ', 'ò'},
+	'u': {'ū', 'ú', 'ǔ', 'ù'},
+	'ü': {'ǖ', 'ǘ', 'ǚ', 'ǜ'},
+	'A': {'Ā', 'Á', 'Ǎ', 'À'},
+	'E': {'Ē', 'É', 'Ě', 'È'},
+	'I': {'Ī', 'Í', 'Ǐ', 'Ì'},
+	'O': {'Ō', 'Ó', 'Ǒ', 'Ò'},
+	'U': {'Ū', 'Ú', 'Ǔ', 'Ù'},
+	'Ü': {'Ǖ', 'Ǘ', 'Ǚ', 'Ǜ'},
+}
+
+// combiningTones are used for syllables without a vowel, such as m2.
+var combiningTones = [4]rune{'\u0304', '\u0301', '\u030c', '\u0300'}
+
+// umlautReplacer converts the ASCII spellings of ü used in numbered pinyin.
+var umlautReplacer = strings.NewReplacer("u:", "ü", "U:", "Ü", "v", "ü", "V", "Ü")
+
+// PinyinMarks converts space separated numbered pinyin, as used by
+// CC-CEDICT, to pinyin with tone marks. For example "nu:3 er2" becomes
+// "nǚ ér". Syllables that do not end in a tone number are left as they
+// are.
+func PinyinMarks(numbered string) string {
+	syllables := strings.Fields(numbered)
+	for i, s := range syllables {
+		syllables[i] = markSyllable(s)
+	}
+	return strings.Join(syllables, " ")
+}
+
+func markSyllable(s string) string {
+	if len(s) < 2 {
+		return s
+	}
+	tone := s[len(s)-1]
+	if tone < '1' || tone > '5' {
+		return s
+	}
+
+	s = umlautReplacer.Replace(s[:len(s)-1])
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			return s + string(tone)
+		}
+	}
+	if tone == '5' {
+		return s
+	}
+
+	rs := []rune(s)
+	i := markPosition(rs)
+	if i < 0 {
+		return string(rs[:1]) + string(combiningTones[tone-'1']) + string(rs[1:])
+	}
+	rs[i] = toneMarks[rs[i]][tone-'1']
+	return string(rs)
+}
+
+// MarkPosition returns the index of the vowel that takes the tone mark, or
+// -1 if the syllable has no vowel. The mark goes on a or e if present, on
+// the o of ou, and otherwise on the last vowel.
+func markPosition(rs []rune) int {
+	last := -1
+	for i, r := range rs {
+		lr := unicode.ToLower(r)
+		if lr == 'a' || lr == 'e' {
+			return i
+		}
+		if lr == 'o' && i+1 < len(rs) && unicode.ToLower(rs[i+1]) == 'u' {
+			return i
+		}
+		if _, ok := toneMarks[r]; ok {
+			last = i
+		}
+	}
+	return last
+}
+
+// GlossaryEntry describes an unknown word for study. Word is the text as
+// it appears in the scanned article. A word with more than one reading
+// has an entry for each, and a word missing from the lexicon has a single
+// entry with only Word set.
+type GlossaryEntry struct {
+	Word        string   `json:"word"`
+	Simplified  string   `json:"simplified,omitempty"`
+	Traditional string   `json:"traditional,omitempty"`
+	Pinyin      string   `json:"pinyin,omitempty"`
+	English     []string `json:"english,omitempty"`
+}
+
+// Glossary looks up every unknown word in the result in the lexicon. Words
+// appear in the same order as UnknownWords. It returns nil if lex is nil.
+func (r Result) Glossary(lex *Lexicon) []GlossaryEntry {
+	if lex == nil {
+		return nil
+	}
+
+	var g []GlossaryEntry
+	for _, w := range r.UnknownWords() {
+		entries := lex.Lookup(w.Word)
+		if len(entries) == 0 {
+			g = append(g, GlossaryEntry{Word: w.Word})
+			continue
+		}
+		for _, e := range entries {
+			g = append(g, GlossaryEntry{
+				Word:        w.Word,
+				Simplified:  e.Simplified,
+				Traditional: e.Traditional,
+				Pinyin:      PinyinMarks(e.Pinyin),
+				English:     e.Definitions,
+			})
+		}
+	}
+	return g
+}
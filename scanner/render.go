@@ -0,0 +1,254 @@
+package scanner
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Renderer writes a marked up version of scanned segments to a writer.
+// Segments are passed in the order they appear in the original text.
+type Renderer interface {
+	Render(w io.Writer, segs []Segment) error
+}
+
+// ContinuedRenderer is implemented by renderers whose output for a segment
+// depends on the segment before it. Stream calls RenderAfter for each chunk
+// after the first, passing the last segment of the chunk before.
+type ContinuedRenderer interface {
+	Renderer
+	RenderAfter(w io.Writer, prev Segment, segs []Segment) error
+}
+
+// DefaultHTML is the renderer used by Scan. It highlights known words
+// using Bootstrap classes.
+var DefaultHTML = HTMLRenderer{Tag: "span", Class: "text-primary border border-primary"}
+
+// HTMLRenderer wraps known words in an HTML element. All text is escaped.
+// If Tag is empty a span is used, if Class is empty no class attribute
+// is written. Tag is written as it is, so it must be a plain element name
+// such as "mark".
+type HTMLRenderer struct {
+	Tag   string
+	Class string
+}
+
+// Render implements the Renderer interface.
+func (h HTMLRenderer) Render(w io.Writer, segs []Segment) error {
+	open, close := h.tags()
+	for _, s := range segs {
+		text := html.EscapeString(s.Text)
+		if s.Kind == Known {
+			text = open + text + close
+		}
+		if _, err := io.WriteString(w, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tags returns the opening and closing tags used to highlight known words.
+func (h HTMLRenderer) tags() (string, string) {
+	tag := h.Tag
+	if tag == "" {
+		tag = "span"
+	}
+
+	if h.Class == "" {
+		return "<" + tag + ">", "</" + tag + ">"
+	}
+	return "<" + tag + " class=\"" + html.EscapeString(h.Class) + "\">", "</" + tag + ">"
+}
+
+// ANSIRenderer colours known and unknown words for display in a terminal.
+// Colours are SGR parameters such as "34" (blue) or "1;31" (bold red).
+// An empty colour leaves the text unchanged.
+type ANSIRenderer struct {
+	Known   string
+	Unknown string
+}
+
+// Render implements the Renderer interface.
+func (a ANSIRenderer) Render(w io.Writer, segs []Segment) error {
+	for _, s := range segs {
+		text := s.Text
+		switch {
+		case s.Kind == Known && a.Known != "":
+			text = "\x1b[" + a.Known + "m" + text + "\x1b[0m"
+		case s.Kind == Unknown && a.Unknown != "":
+			text = "\x1b[" + a.Unknown + "m" + text + "\x1b[0m"
+		}
+		if _, err := io.WriteString(w, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarkdownRenderer emboldens known words. Markdown control characters
+// in the text are escaped. Because Chinese text has no spaces between
+// words, adjacent known words are separated by a zero width space so
+// that their emphasis markers do not run together.
+type MarkdownRenderer struct{}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"`", "\\`",
+	`*`, `\*`,
+	`_`, `\_`,
+	`[`, `\[`,
+	`]`, `\]`,
+	`<`, `\<`,
+)
+
+// Render implements the Renderer interface.
+func (m MarkdownRenderer) Render(w io.Writer, segs []Segment) error {
+	return m.RenderAfter(w, Segment{}, segs)
+}
+
+// RenderAfter implements the ContinuedRenderer interface.
+func (MarkdownRenderer) RenderAfter(w io.Writer, last Segment, segs []Segment) error {
+	prev := last.Kind
+	for _, s := range segs {
+		text := markdownEscaper.Replace(s.Text)
+		if s.Kind == Known {
+			text = "**" + text + "**"
+			if prev == Known {
+				text = "\u200b" + text
+			}
+		}
+		if _, err := io.WriteString(w, text); err != nil {
+			return err
+		}
+		prev = s.Kind
+	}
+	return nil
+}
+
+// BracketRenderer surrounds known words with plain text delimiters. If
+// both Open and Close are empty, square brackets are used.
+type BracketRenderer struct {
+	Open  string
+	Close string
+}
+
+// Render implements the Renderer interface.
+func (b BracketRenderer) Render(w io.Writer, segs []Segment) error {
+	open, close := b.Open, b.Close
+	if open == "" && close == "" {
+		open, close = "[", "]"
+	}
+
+	for _, s := range segs {
+		text := s.Text
+		if s.Kind == Known {
+			text = open + text + close
+		}
+		if _, err := io.WriteString(w, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RubyRenderer annotates Han characters with pinyin using HTML ruby
+// markup. Only unknown words are annotated unless All is set. Known words
+// are highlighted in the same way as the HTML renderer. Readings come from
+// the lexicon, which is required.
+type RubyRenderer struct {
+	Lexicon *Lexicon
+	HTML    HTMLRenderer
+	All     bool
+}
+
+// Render implements the Renderer interface.
+func (rr RubyRenderer) Render(w io.Writer, segs []Segment) error {
+	if rr.Lexicon == nil {
+		return fmt.Errorf("ruby markup requires a lexicon")
+	}
+
+	open, close := rr.HTML.tags()
+	for _, s := range segs {
+		text := html.EscapeString(s.Text)
+		if s.Kind == Unknown || (s.Kind == Known && rr.All) {
+			text = rr.ruby(s.Text)
+		}
+		if s.Kind == Known {
+			text = open + text + close
+		}
+		if _, err := io.WriteString(w, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ruby returns a ruby element pairing each rune of a word with its reading.
+func (rr RubyRenderer) ruby(word string) string {
+	var b strings.Builder
+	b.WriteString("<ruby>")
+	readings := rr.Lexicon.Readings(word)
+	for i, r := range []rune(word) {
+		b.WriteString(html.EscapeString(string(r)))
+		b.WriteString("<rt>" + html.EscapeString(readings[i]) + "</rt>")
+	}
+	b.WriteString("</ruby>")
+	return b.String()
+}
+
+// tagPattern matches the element names accepted by MarkupOptions.
+var tagPattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// MarkupOptions selects a renderer by name. It is intended to be decoded
+// from an API request. Tag and Class only apply to the HTML and ruby
+// formats.
+type MarkupOptions struct {
+	Format string `json:"format"`
+	Tag    string `json:"tag,omitempty"`
+	Class  string `json:"class,omitempty"`
+}
+
+// Renderer returns the renderer described by the options. An empty
+// format selects DefaultHTML. The ruby formats take their readings from
+// lex. It returns an error if the format is not recognised, if the tag is
+// not a plain lower case element name, or if a ruby format is requested
+// without a lexicon.
+func (o MarkupOptions) Renderer(lex *Lexicon) (Renderer, error) {
+	h := DefaultHTML
+	if o.Tag != "" {
+		if !tagPattern.MatchString(o.Tag) {
+			return nil, fmt.Errorf("invalid markup tag: %q", o.Tag)
+		}
+		h.Tag = o.Tag
+	}
+	if o.Class != "" {
+		h.Class = o.Class
+	}
+
+	switch o.Format {
+	case "", "html":
+		return h, nil
+	case "ansi":
+		return ANSIRenderer{Known: "34"}, nil
+	case "markdown":
+		return MarkdownRenderer{}, nil
+	case "brackets":
+		return BracketRenderer{}, nil
+	case "ruby", "ruby-all":
+		if lex == nil {
+			return nil, fmt.Errorf("markup format %q requires a lexicon", o.Format)
+		}
+		return RubyRenderer{Lexicon: lex, HTML: h, All: o.Format == "ruby-all"}, nil
+	}
+	return nil, fmt.Errorf("unknown markup format: %q", o.Format)
+}
+
+// Markup renders the segments of a result to a string.
+func (r Result) Markup(rend Renderer) (string, error) {
+	var b strings.Builder
+	err := rend.Render(&b, r.Segments)
+	return b.String(), err
+}
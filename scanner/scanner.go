@@ -1,92 +1,207 @@
+// Package scanner matches Chinese text against a list of known words. The
+// dictionaries, lexicons, conversion tables and word lists it loads are
+// not modified afterwards, so each may be shared between goroutines.
 package scanner
 
 import (
-	"bufio"
-	"io"
+	"errors"
 	"strings"
-	"unicode"
 	"unicode/utf8"
 )
 
+// Kind classifies a segment of scanned text.
+type Kind int
+
+const (
+	// NonHan segments hold text that is not part of a known word and is
+	// not scored as unknown, such as punctuation, numbers or Latin script
+	// under the default policy.
+	NonHan Kind = iota
+
+	// Known segments hold a word that matched the known list.
+	Known
+
+	// Unknown segments hold a Han character, a word from the lexicon, or
+	// other scored text that is not in the known list.
+	Unknown
+)
+
+var kindNames = map[Kind]string{
+	NonHan:  "non-han",
+	Known:   "known",
+	Unknown: "unknown",
+}
+
+// String returns the name of the kind as used in JSON output.
+func (k Kind) String() string {
+	if n, ok := kindNames[k]; ok {
+		return n
+	}
+	return "invalid"
+}
+
+// MarshalText allows a Kind to be encoded by name.
+func (k Kind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Segment is a contiguous piece of scanned text. Offsets are half open
+// and are given both in runes and in bytes into the original text, where
+// each invalid UTF-8 byte counts as one rune. Entry
+// is the word from the known list that matched, and Entries holds any
+// lexicon entries for the segment when a lexicon was used.
+type Segment struct {
+	Text      string          `json:"text"`
+	Start     int             `json:"start"`
+	End       int             `json:"end"`
+	ByteStart int             `json:"byte_start"`
+	ByteEnd   int             `json:"byte_end"`
+	Kind      Kind            `json:"kind"`
+	Entry     string          `json:"entry,omitempty"`
+	Entries   []*LexiconEntry `json:"entries,omitempty"`
+}
+
+// Result holds the outcome of a scan. Segments cover the whole of the
+// original text in order. Known and Unknown count the characters that
+// matched and failed to match the known list, as set by the scan policy.
+type Result struct {
+	Segments []Segment `json:"segments"`
+	Known    int       `json:"known"`
+	Unknown  int       `json:"unknown"`
+
+	policy Policy
+}
+
+// ErrNoScorableText is returned by Scan when a text has no characters
+// that count towards the score, such as an empty string or a text written
+// entirely in English. A score is not meaningful for such a text.
+var ErrNoScorableText = errors.New("text has no characters to score")
+
+// Scorable reports whether the result has any characters that count
+// towards the score.
+func (r Result) Scorable() bool {
+	return r.Known+r.Unknown > 0
+}
+
+// Score returns the percentage of scored characters that exist in the
+// known list. It returns 0 if the result is not scorable.
+func (r Result) Score() int {
+	if !r.Scorable() {
+		return 0
+	}
+	return r.Known * 100 / (r.Known + r.Unknown)
+}
+
 // Scan looks through a string of text and matches characters against
 // a list of known characters. It returns an overall match score which
 // indicates the percentage of characters that exist in the known list
 // and a marked up version of the original text highlighting known
 // characters. It returns an error if it is unable to parse the text.
+// If the text has no characters to score, it returns a score of 0 with
+// the markup and ErrNoScorableText.
 func Scan(text, known string) (int, string, error) {
-
-	found := 0
-	miss := 0
-	markup := ""
-
-	r := strings.NewReader(known)
-	ws, err := mapWords(r)
+	res, err := Analyse(text, known)
 	if err != nil {
-		return 0, markup, err
+		return 0, "", err
 	}
 
-	maxknown := 0
-	for i := range ws {
-		if utf8.RuneCountInString(i) > maxknown {
-			maxknown = utf8.RuneCountInString(i)
-		}
+	markup, err := res.Markup(DefaultHTML)
+	if err != nil {
+		return 0, "", err
 	}
 
-	rs := []rune(text)
-out:
-	for i := 0; i < len(rs); i++ {
-		max := i + maxknown
-		if max > len(rs) {
-			max = len(rs)
-		}
-
-		for mi := max; mi > i; mi-- {
-			if ws[string(rs[i:mi])] == true {
-				markup = markup + "<span class=\"text-primary border border-primary\">" + string(rs[i:mi]) + "</span>"
-				found += (mi - i)
-				i = mi - 1
-				continue out
-			}
-		}
-		if i > len(rs) {
-			break out
-		}
-		markup += string(rs[i])
-
-		if unicode.Is(unicode.Han, rs[i]) {
-			miss++
-		}
-
+	if !res.Scorable() {
+		return 0, markup, ErrNoScorableText
 	}
 
-	score := found * 100 / (found + miss)
-
-	return score, markup, nil
+	return res.Score(), markup, nil
 }
 
-// MapWords takes a reader on a byte stream and returns a map of words.
-// Words in the byte stream should be line separated. It returns an error
-// if it fails to read from the reader.
-func mapWords(r io.Reader) (map[string]bool, error) {
+// Analyse looks through a string of text and matches words against a
+// list of known words, longest match first. It returns the text broken
+// into known, unknown and non-Han segments along with character counts.
+// It returns an error if it is unable to parse the known list. Callers
+// scanning many texts against the same list should use a Dictionary.
+func Analyse(text, known string) (Result, error) {
+	d, err := NewDictionary(strings.NewReader(known))
+	if err != nil {
+		return Result{}, err
+	}
+	return d.Scan(text), nil
+}
 
-	words := map[string]bool{}
+// builder accumulates segments over a slice of runes, tracking byte
+// offsets as it goes. Segment text is sliced from the original string
+// rather than copied. Consecutive non-Han runes are merged into a single
+// segment. If norm is set it holds the normalised runes that were matched
+// against the known list. If offs is set it holds the byte offset of each
+// rune in the original text, followed by the length of the text.
+type builder struct {
+	text     string
+	rs       []rune
+	norm     []rune
+	offs     []int
+	bytes    int
+	segments []Segment
+}
 
-	// use a buffered reader to make use of the readline functionality
-	br := bufio.NewReader(r)
+func newBuilder(text string, rs []rune) *builder {
+	b := &builder{text: text, rs: rs, segments: make([]Segment, 0, len(rs)/2)}
 
-	for {
-		b, _, err := br.ReadLine()
+	// each invalid byte becomes a U+FFFD in rs, which is longer than the
+	// byte it replaces, so record where every rune starts
+	if !utf8.ValidString(text) {
+		b.offs = make([]int, 0, len(rs)+1)
+		for i := range text {
+			b.offs = append(b.offs, i)
+		}
+		b.offs = append(b.offs, len(text))
+	}
+	return b
+}
 
-		if err != nil {
-			if err == io.EOF {
-				break
+// Add appends the runes in [start, end) as a segment of the given kind.
+// Segments must be added in order and without gaps. Known segments record
+// the text that was matched as their entry.
+func (b *builder) add(start, end int, k Kind) {
+	size := 0
+	if b.offs != nil {
+		size = b.offs[end] - b.offs[start]
+	} else {
+		for _, r := range b.rs[start:end] {
+			size += utf8.RuneLen(r)
+		}
+	}
+	n := len(b.segments)
+
+	if k == NonHan && n > 0 && b.segments[n-1].Kind == NonHan {
+		last := &b.segments[n-1]
+		last.End = end
+		last.ByteEnd += size
+		last.Text = b.text[last.ByteStart:last.ByteEnd]
+	} else {
+		text := b.text[b.bytes : b.bytes+size]
+		entry := ""
+		if k == Known {
+			switch {
+			case b.norm != nil:
+				entry = string(b.norm[start:end])
+			case b.offs != nil:
+				entry = string(b.rs[start:end])
+			default:
+				entry = text
 			}
-
-			return words, err
 		}
-
-		words[strings.TrimSpace(string(b))] = true
+		b.segments = append(b.segments, Segment{
+			Text:      text,
+			Start:     start,
+			End:       end,
+			ByteStart: b.bytes,
+			ByteEnd:   b.bytes + size,
+			Kind:      k,
+			Entry:     entry,
+		})
 	}
 
-	return words, nil
+	b.bytes += size
 }
@@ -1,6 +1,15 @@
 package scanner
 
-import "testing"
+import (
+	"encoding/json"
+	"html"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
 
 func TestScanSingleChar(t *testing.T) {
 	known := `一
@@ -29,3 +38,1118 @@ func TestScanSingleChar(t *testing.T) {
 		t.Errorf("unexpected markup returned:\n\twant: %s\n\tgot:  %s", dMarkup, markup)
 	}
 }
+
+func TestAnalyseSegments(t *testing.T) {
+	known := "一个人\n我\n知道"
+	text := "我知道, 一个人吗"
+
+	want := []Segment{
+		{Text: "我", Start: 0, End: 1, ByteStart: 0, ByteEnd: 3, Kind: Known, Entry: "我"},
+		{Text: "知道", Start: 1, End: 3, ByteStart: 3, ByteEnd: 9, Kind: Known, Entry: "知道"},
+		{Text: ", ", Start: 3, End: 5, ByteStart: 9, ByteEnd: 11, Kind: NonHan},
+		{Text: "一个人", Start: 5, End: 8, ByteStart: 11, ByteEnd: 20, Kind: Known, Entry: "一个人"},
+		{Text: "吗", Start: 8, End: 9, ByteStart: 20, ByteEnd: 23, Kind: Unknown},
+	}
+
+	res, err := Analyse(text, known)
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	if len(res.Segments) != len(want) {
+		t.Fatalf("unexpected number of segments: want %d, got %d: %+v", len(want), len(res.Segments), res.Segments)
+	}
+	for i := range want {
+		if !reflect.DeepEqual(res.Segments[i], want[i]) {
+			t.Errorf("unexpected segment %d:\n\twant: %+v\n\tgot:  %+v", i, want[i], res.Segments[i])
+		}
+	}
+	if res.Known != 6 || res.Unknown != 1 {
+		t.Errorf("unexpected counts: want 6 known, 1 unknown, got %d known, %d unknown", res.Known, res.Unknown)
+	}
+}
+
+func TestRenderers(t *testing.T) {
+	res, err := Analyse("我知道<你>", "我\n知道\n你")
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+
+	tests := []struct {
+		name string
+		rend Renderer
+		want string
+	}{
+		{"default html", DefaultHTML, `<span class="text-primary border border-primary">我</span><span class="text-primary border border-primary">知道</span>&lt;<span class="text-primary border border-primary">你</span>&gt;`},
+		{"html tag", HTMLRenderer{Tag: "mark"}, "<mark>我</mark><mark>知道</mark>&lt;<mark>你</mark>&gt;"},
+		{"ansi", ANSIRenderer{Known: "34"}, "\x1b[34m我\x1b[0m\x1b[34m知道\x1b[0m<\x1b[34m你\x1b[0m>"},
+		{"markdown", MarkdownRenderer{}, "**我**\u200b**知道**\\<**你**>"},
+		{"brackets", BracketRenderer{}, "[我][知道]<[你]>"},
+	}
+
+	for _, tc := range tests {
+		got, err := res.Markup(tc.rend)
+		if err != nil {
+			t.Errorf("%s: unexpected error returned: %s", tc.name, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s: unexpected markup returned:\n\twant: %q\n\tgot:  %q", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestMarkupOptions(t *testing.T) {
+	r, err := MarkupOptions{Format: "html", Class: "known"}.Renderer(nil)
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	if want := (HTMLRenderer{Tag: "span", Class: "known"}); r != want {
+		t.Errorf("unexpected renderer returned: want %+v, got %+v", want, r)
+	}
+
+	if _, err := (MarkupOptions{Format: "pdf"}).Renderer(nil); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+	if _, err := (MarkupOptions{Format: "ruby"}).Renderer(nil); err == nil {
+		t.Errorf("expected an error for ruby markup without a lexicon")
+	}
+
+	for _, tag := range []string{"mark", "x-known", "h1"} {
+		if _, err := (MarkupOptions{Tag: tag}).Renderer(nil); err != nil {
+			t.Errorf("unexpected error returned for tag %q: %s", tag, err)
+		}
+	}
+	for _, tag := range []string{"span onclick=alert(1)", "b><script>", "1b", "SPAN", "-x"} {
+		if _, err := (MarkupOptions{Tag: tag}).Renderer(nil); err == nil {
+			t.Errorf("expected an error for tag %q", tag)
+		}
+	}
+}
+
+func TestDictionaryConcurrentScan(t *testing.T) {
+	d, err := NewDictionary(strings.NewReader("我\n知道\n一个人"))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+
+	want := d.Scan("我知道一个人吗")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got := d.Scan("我知道一个人吗")
+			if got.Known != want.Known || got.Unknown != want.Unknown || len(got.Segments) != len(want.Segments) {
+				t.Errorf("unexpected result from concurrent scan: want %+v, got %+v", want, got)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestTrieLongest(t *testing.T) {
+	var tr trie
+	for _, w := range []string{"一", "一个", "一个人", "人们"} {
+		tr.insert([]rune(w))
+	}
+
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"一个人们", 3},
+		{"一个们", 2},
+		{"一人", 1},
+		{"人", 0},
+		{"", 0},
+	}
+
+	for _, tc := range tests {
+		if got := tr.longest([]rune(tc.text)); got != tc.want {
+			t.Errorf("unexpected longest match for %q: want %d, got %d", tc.text, tc.want, got)
+		}
+	}
+}
+
+// benchWords returns a deterministic list of n words between one and
+// eight characters long, and a text of roughly size characters made up
+// of those words mixed with characters that are not in the list.
+func benchWords(n, size int) ([]string, string) {
+	rnd := rand.New(rand.NewSource(1))
+	han := func() rune { return rune(0x4e00 + rnd.Intn(0x9fa5-0x4e00)) }
+
+	words := make([]string, n)
+	for i := range words {
+		rs := make([]rune, 1+rnd.Intn(8))
+		for j := range rs {
+			rs[j] = han()
+		}
+		words[i] = string(rs)
+	}
+
+	var text []rune
+	for len(text) < size {
+		if rnd.Intn(4) == 0 {
+			text = append(text, han(), '，')
+			continue
+		}
+		text = append(text, []rune(words[rnd.Intn(n)])...)
+	}
+	return words, string(text)
+}
+
+// mapScan is the map based forward maximum match that the trie replaced.
+// It is kept as a baseline for the benchmarks.
+func mapScan(text string, ws map[string]bool, maxknown int) int {
+	found := 0
+	rs := []rune(text)
+	for i := 0; i < len(rs); i++ {
+		max := i + maxknown
+		if max > len(rs) {
+			max = len(rs)
+		}
+		for mi := max; mi > i; mi-- {
+			if ws[string(rs[i:mi])] {
+				found += mi - i
+				i = mi - 1
+				break
+			}
+		}
+	}
+	return found
+}
+
+// trieScan is mapScan using the trie longest match walk.
+func trieScan(text string, t *trie) int {
+	found := 0
+	rs := []rune(text)
+	for i := 0; i < len(rs); i++ {
+		if l := t.longest(rs[i:]); l > 0 {
+			found += l
+			i += l - 1
+		}
+	}
+	return found
+}
+
+func BenchmarkMapScan(b *testing.B) {
+	words, text := benchWords(20000, 100000)
+	ws := map[string]bool{}
+	maxknown := 0
+	for _, w := range words {
+		ws[w] = true
+		if n := len([]rune(w)); n > maxknown {
+			maxknown = n
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		mapScan(text, ws, maxknown)
+	}
+}
+
+func BenchmarkTrieScan(b *testing.B) {
+	words, text := benchWords(20000, 100000)
+	var t trie
+	for _, w := range words {
+		t.insert([]rune(w))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		trieScan(text, &t)
+	}
+}
+
+func BenchmarkDictionaryScan(b *testing.B) {
+	words, text := benchWords(20000, 100000)
+	d, err := NewDictionary(strings.NewReader(strings.Join(words, "\n")))
+	if err != nil {
+		b.Fatalf("unexpected error returned: %s", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d.Scan(text)
+	}
+}
+
+func TestAnalyseInvalidUTF8(t *testing.T) {
+	res, err := Analyse("我\xff知道", "我\n知道")
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	if res.Known != 3 {
+		t.Errorf("unexpected known count: want 3, got %d", res.Known)
+	}
+	if got := res.Segments[1].Text; got != "\xff" {
+		t.Errorf("unexpected invalid segment: want %q, got %q", "\xff", got)
+	}
+
+	// byte offsets point into the original text
+	text := "我\xff知道\xfe\xfd。"
+	res, err = Analyse(text, "我\n知道")
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	for _, s := range res.Segments {
+		if text[s.ByteStart:s.ByteEnd] != s.Text {
+			t.Errorf("segment offsets do not match text: %q != %q", text[s.ByteStart:s.ByteEnd], s.Text)
+		}
+	}
+	if last := res.Segments[len(res.Segments)-1]; last.End != 7 || last.ByteEnd != len(text) {
+		t.Errorf("unexpected end of text: want rune %d byte %d, got rune %d byte %d", 7, len(text), last.End, last.ByteEnd)
+	}
+	for _, p := range res.Sentences() {
+		if text[p.ByteStart:p.ByteEnd] != p.Text {
+			t.Errorf("passage offsets do not match text: %q != %q", text[p.ByteStart:p.ByteEnd], p.Text)
+		}
+	}
+}
+
+func TestSegmenters(t *testing.T) {
+	tests := []struct {
+		text  string
+		known string
+		seg   Segmenter
+		want  []string
+	}{
+		{"研究生命起源", "研究\n研究生\n生命\n命\n起源", ForwardMatch, []string{"研究生", "命", "起源"}},
+		{"研究生命起源", "研究\n研究生\n生命\n命\n起源", BackwardMatch, []string{"研究", "生命", "起源"}},
+		{"研究生命起源", "研究\n研究生\n生命\n命\n起源", BidirectionalMatch, []string{"研究", "生命", "起源"}},
+		{"结合成分子", "结合\n合成\n成分\n分子", ForwardMatch, []string{"结合", "成分", "子"}},
+		{"结合成分子", "结合\n合成\n成分\n分子", BackwardMatch, []string{"结", "合成", "分子"}},
+		{"结合成分子", "结合\n合成\n成分\n分子", BidirectionalMatch, []string{"结", "合成", "分子"}},
+		{"大学生活", "大学\n学生\n生活", ForwardMatch, []string{"大学", "生活"}},
+		{"大学生活", "大学\n学生\n生活", BackwardMatch, []string{"大学", "生活"}},
+		{"乒乓球拍卖完了", "乒乓\n乒乓球\n球拍\n拍卖\n卖完\n完了", ForwardMatch, []string{"乒乓球", "拍卖", "完了"}},
+		{"乒乓球拍卖完了", "乒乓\n乒乓球\n球拍\n拍卖\n卖完\n完了", BidirectionalMatch, []string{"乒乓球", "拍卖", "完了"}},
+		{"北京大学生", "北京\n北京大学\n大学生\n学生", ForwardMatch, []string{"北京大学", "生"}},
+		{"北京大学生", "北京\n北京大学\n大学生\n学生", BackwardMatch, []string{"北京", "大学生"}},
+		{"北京大学生", "北京\n北京大学\n大学生\n学生", BidirectionalMatch, []string{"北京", "大学生"}},
+		{"和平等", "和平\n平等\n和", BidirectionalMatch, []string{"和", "平等"}},
+		{"研究生命。好运动员。", "研究\n研究生\n生命\n好运\n运动员\n动员", BidirectionalMatch, []string{"研究", "生命", "。", "好运", "动员", "。"}},
+	}
+
+	for _, tc := range tests {
+		d, err := NewDictionary(strings.NewReader(tc.known))
+		if err != nil {
+			t.Fatalf("unexpected error returned: %s", err)
+		}
+
+		res := d.ScanWith(tc.text, Options{Segmenter: tc.seg})
+		var got []string
+		for _, s := range res.Segments {
+			got = append(got, s.Text)
+		}
+		if strings.Join(got, "/") != strings.Join(tc.want, "/") {
+			t.Errorf("%s %s: want %s, got %s", tc.seg, tc.text, strings.Join(tc.want, "/"), strings.Join(got, "/"))
+		}
+	}
+}
+
+func TestParseSegmenter(t *testing.T) {
+	for _, s := range []Segmenter{ForwardMatch, BackwardMatch, BidirectionalMatch} {
+		got, err := ParseSegmenter(s.String())
+		if err != nil || got != s {
+			t.Errorf("unexpected result parsing %q: got %v, %v", s, got, err)
+		}
+	}
+	if _, err := ParseSegmenter("sideways"); err == nil {
+		t.Errorf("expected an error for an unknown segmenter")
+	}
+}
+
+const testCEDICT = `# CC-CEDICT sample
+信用 信用 [xin4 yong4] /to trust/credit (commerce)/
+信用卡 信用卡 [xin4 yong4 ka3] /credit card/
+卡 卡 [ka3] /card/CL:張|张[zhang1],片[pian4]/
+我 我 [wo3] /I/me/my/
+銀行 银行 [yin2 hang2] /bank/CL:家[jia1],個|个[ge4]/
+行 行 [hang2] /row/line/commercial firm/
+行 行 [xing2] /to walk/to go/capable/
+行動 行动 [xing2 dong4] /operation/action/
+旅行 旅行 [lu:3 xing2] /to travel/journey/
+有 有 [you3] /to have/there is/
+張 张 [zhang1] /to open up/classifier for flat objects/
+`
+
+func TestLoadCEDICT(t *testing.T) {
+	lex, err := LoadCEDICT(strings.NewReader(testCEDICT))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	if lex.Len() != 11 {
+		t.Errorf("unexpected number of entries: want 11, got %d", lex.Len())
+	}
+
+	want := &LexiconEntry{Traditional: "張", Simplified: "张", Pinyin: "zhang1", Definitions: []string{"to open up", "classifier for flat objects"}}
+	for _, w := range []string{"张", "張"} {
+		got := lex.Lookup(w)
+		if len(got) != 1 || !reflect.DeepEqual(got[0], want) {
+			t.Errorf("unexpected entries for %s: want %+v, got %+v", w, want, got)
+		}
+	}
+
+	if _, err := LoadCEDICT(strings.NewReader("信用 信用 xin4 yong4 /credit/")); err == nil {
+		t.Errorf("expected an error for a malformed entry")
+	}
+}
+
+func TestScanWithLexicon(t *testing.T) {
+	lex, err := LoadCEDICT(strings.NewReader(testCEDICT))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	d, err := NewDictionary(strings.NewReader("我\n有\n张"))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+
+	for _, seg := range []Segmenter{ForwardMatch, BackwardMatch, BidirectionalMatch} {
+		res := d.ScanWith("我有一张信用卡", Options{Segmenter: seg, Lexicon: lex})
+
+		var got []string
+		for _, s := range res.Segments {
+			got = append(got, s.Kind.String()+":"+s.Text)
+		}
+		want := "known:我 known:有 unknown:一 known:张 unknown:信用卡"
+		if strings.Join(got, " ") != want {
+			t.Errorf("%s: unexpected segments:\n\twant: %s\n\tgot:  %s", seg, want, strings.Join(got, " "))
+		}
+		if res.Known != 3 || res.Unknown != 4 {
+			t.Errorf("%s: unexpected counts: want 3 known, 4 unknown, got %d known, %d unknown", seg, res.Known, res.Unknown)
+		}
+		if last := res.Segments[len(res.Segments)-1]; len(last.Entries) != 1 || last.Entries[0].Pinyin != "xin4 yong4 ka3" {
+			t.Errorf("%s: unexpected lexicon entries for %s: %+v", seg, last.Text, last.Entries)
+		}
+	}
+}
+
+func TestScanWithLexiconKnownCharacters(t *testing.T) {
+	lex, err := LoadCEDICT(strings.NewReader("我們 我们 [wo3 men5] /we/us/\n"))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+
+	tests := []struct {
+		known string
+		want  string
+	}{
+		{"我\n们", "known:我 known:们 unknown:好"},
+		{"我", "unknown:我们 unknown:好"},
+	}
+
+	for _, tc := range tests {
+		d, err := NewDictionary(strings.NewReader(tc.known))
+		if err != nil {
+			t.Fatalf("unexpected error returned: %s", err)
+		}
+
+		for _, seg := range []Segmenter{ForwardMatch, BackwardMatch, BidirectionalMatch} {
+			res := d.ScanWith("我们好", Options{Segmenter: seg, Lexicon: lex})
+
+			var got []string
+			for _, s := range res.Segments {
+				got = append(got, s.Kind.String()+":"+s.Text)
+			}
+			if strings.Join(got, " ") != tc.want {
+				t.Errorf("%s %q: unexpected segments:\n\twant: %s\n\tgot:  %s", seg, tc.known, tc.want, strings.Join(got, " "))
+			}
+		}
+	}
+}
+
+func TestUnknownWords(t *testing.T) {
+	res, err := Analyse("他说他的猫和她的狗都是猫。", "的\n都\n是\n和")
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+
+	want := []WordCount{
+		{"他", 2}, {"猫", 2}, {"说", 1}, {"她", 1}, {"狗", 1},
+	}
+	if got := res.UnknownWords(); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected unknown words:\n\twant: %v\n\tgot:  %v", want, got)
+	}
+}
+
+func TestPinyinMarks(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"ni3 hao3", "nǐ hǎo"},
+		{"xin4 yong4 ka3", "xìn yòng kǎ"},
+		{"nu:3 er2", "nǚ ér"},
+		{"lv4", "lǜ"},
+		{"gui4 zhou1", "guì zhōu"},
+		{"dou1 liu2", "dōu liú"},
+		{"Ou1 zhou1", "Ōu zhōu"},
+		{"xie4 xie5", "xiè xie"},
+		{"hua4 r5", "huà r"},
+		{"m2", "m\u0301"},
+		{"A A zhi4", "A A zhì"},
+		{"ka3 la1 O K", "kǎ lā O K"},
+	}
+
+	for _, tc := range tests {
+		if got := PinyinMarks(tc.in); got != tc.want {
+			t.Errorf("unexpected pinyin for %q: want %q, got %q", tc.in, tc.want, got)
+		}
+	}
+}
+
+func TestGlossary(t *testing.T) {
+	lex, err := LoadCEDICT(strings.NewReader(testCEDICT))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	d, err := NewDictionary(strings.NewReader("我\n有"))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+
+	res := d.ScanWith("我有信用卡和信用卡", Options{Lexicon: lex})
+	want := []GlossaryEntry{
+		{Word: "信用卡", Simplified: "信用卡", Traditional: "信用卡", Pinyin: "xìn yòng kǎ", English: []string{"credit card"}},
+		{Word: "和"},
+	}
+	if got := res.Glossary(lex); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected glossary:\n\twant: %+v\n\tgot:  %+v", want, got)
+	}
+}
+
+func TestReadings(t *testing.T) {
+	lex, err := LoadCEDICT(strings.NewReader(testCEDICT))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+
+	tests := []struct {
+		word string
+		want []string
+	}{
+		{"银行", []string{"yín", "háng"}},
+		{"行", []string{"xíng"}},
+		{"我行", []string{"wǒ", "xíng"}},
+		{"信用卡，", []string{"xìn", "yòng", "kǎ", ""}},
+	}
+
+	for _, tc := range tests {
+		if got := lex.Readings(tc.word); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("unexpected readings for %s: want %q, got %q", tc.word, tc.want, got)
+		}
+	}
+}
+
+func TestRubyRenderer(t *testing.T) {
+	lex, err := LoadCEDICT(strings.NewReader(testCEDICT))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	d, err := NewDictionary(strings.NewReader("我"))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	res := d.ScanWith("我去银行。", Options{Lexicon: lex})
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"ruby", `<span class="text-primary border border-primary">我</span><ruby>去<rt></rt></ruby><ruby>银<rt>yín</rt>行<rt>háng</rt></ruby>。`},
+		{"ruby-all", `<span class="text-primary border border-primary"><ruby>我<rt>wǒ</rt></ruby></span><ruby>去<rt></rt></ruby><ruby>银<rt>yín</rt>行<rt>háng</rt></ruby>。`},
+	}
+
+	for _, tc := range tests {
+		rend, err := MarkupOptions{Format: tc.format}.Renderer(lex)
+		if err != nil {
+			t.Fatalf("unexpected error returned: %s", err)
+		}
+		got, err := res.Markup(rend)
+		if err != nil {
+			t.Errorf("%s: unexpected error returned: %s", tc.format, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s: unexpected markup returned:\n\twant: %s\n\tgot:  %s", tc.format, tc.want, got)
+		}
+	}
+
+	// readings come from a data file and are escaped like the text
+	lex, err = LoadCEDICT(strings.NewReader("书 书 [<i>shu1] /book/\n"))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	got, err := d.ScanWith("书", Options{Lexicon: lex}).Markup(RubyRenderer{Lexicon: lex, HTML: DefaultHTML})
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	if strings.Contains(got, "<i>") {
+		t.Errorf("unexpected unescaped reading: %s", got)
+	}
+}
+
+const testConversions = `# traditional to simplified
+們 们
+個 个
+東 东
+這 这
+書 书
+頭 头
+髮 发
+發 发
+頭髮 头发
+乾 干
+乾淨 干净
+`
+
+func TestConverter(t *testing.T) {
+	c, err := LoadConverter(strings.NewReader(testConversions))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+
+	tests := []struct {
+		in, want string
+	}{
+		{"這個東西", "这个东西"},
+		{"頭髮乾淨", "头发干净"},
+		{"already simplified", "already simplified"},
+	}
+	for _, tc := range tests {
+		if got := c.Convert(tc.in); got != tc.want {
+			t.Errorf("unexpected conversion of %s: want %s, got %s", tc.in, tc.want, got)
+		}
+	}
+}
+
+func TestScanWithConverter(t *testing.T) {
+	c, err := LoadConverter(strings.NewReader(testConversions))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+
+	// a simplified list reading traditional text, and the reverse
+	tests := []struct {
+		known, text string
+		entries     []string
+	}{
+		{"这个\n书", "這個書", []string{"这个", "书"}},
+		{"這個\n書", "这个书", []string{"这个", "书"}},
+	}
+
+	for _, tc := range tests {
+		d, err := NewDictionary(strings.NewReader(tc.known))
+		if err != nil {
+			t.Fatalf("unexpected error returned: %s", err)
+		}
+
+		if res := d.Scan(tc.text); res.Known != 0 {
+			t.Errorf("%s: unexpected matches without normalisation: %d", tc.text, res.Known)
+		}
+
+		res := d.ScanWith(tc.text, Options{Converter: c})
+		if res.Known != 3 || res.Unknown != 0 {
+			t.Errorf("%s: unexpected counts: want 3 known, 0 unknown, got %d known, %d unknown", tc.text, res.Known, res.Unknown)
+		}
+		markup, _ := res.Markup(BracketRenderer{})
+		if want := "[" + string([]rune(tc.text)[:2]) + "][" + string([]rune(tc.text)[2:]) + "]"; markup != want {
+			t.Errorf("%s: unexpected markup: want %s, got %s", tc.text, want, markup)
+		}
+		for i, s := range res.Segments {
+			if s.Entry != tc.entries[i] {
+				t.Errorf("%s: unexpected entry: want %s, got %s", tc.text, tc.entries[i], s.Entry)
+			}
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	lex, err := LoadCEDICT(strings.NewReader(testCEDICT))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	d, err := NewDictionary(strings.NewReader("我\n有\n一张\n信用"))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+
+	// the first half favours forward matching and the second backward
+	bd, err := NewDictionary(strings.NewReader("甲乙\n乙丙丁\n丙丁\n研究\n研究生\n生命"))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+
+	// repeat the text so that words are certain to span chunk boundaries
+	text := strings.Repeat("我有一张信用卡。", streamChunk/3)
+	halves := strings.Repeat("甲乙丙丁。", 1019) + strings.Repeat("研究生命。", 919)
+	invalid := strings.Repeat("我有\xff一张信用卡\xe4\xbd。", streamChunk/3)
+	adjacent := strings.Repeat("我有", streamChunk)
+
+	tests := []struct {
+		d    *Dictionary
+		text string
+		opts Options
+		rend Renderer
+	}{
+		{d, text, Options{}, BracketRenderer{}},
+		{d, text, Options{Lexicon: lex}, BracketRenderer{}},
+		{d, text, Options{Segmenter: BidirectionalMatch, Lexicon: lex}, BracketRenderer{}},
+		{bd, halves, Options{Segmenter: BidirectionalMatch}, BracketRenderer{}},
+		{d, invalid, Options{}, BracketRenderer{}},
+		{d, adjacent, Options{}, MarkdownRenderer{}},
+	}
+
+	for i, tc := range tests {
+		d, text, opts := tc.d, tc.text, tc.opts
+		want := d.ScanWith(text, opts)
+		wantMarkup, _ := want.Markup(tc.rend)
+
+		var b strings.Builder
+		got, err := d.Stream(&b, strings.NewReader(text), tc.rend, opts)
+		if err != nil {
+			t.Fatalf("unexpected error returned: %s", err)
+		}
+		if got.Known != want.Known || got.Unknown != want.Unknown {
+			t.Errorf("%d: unexpected counts: want %d known, %d unknown, got %d known, %d unknown", i, want.Known, want.Unknown, got.Known, got.Unknown)
+		}
+		if b.String() != wantMarkup {
+			t.Errorf("%d: streamed markup differs from a whole text scan", i)
+		}
+	}
+}
+
+func TestScorers(t *testing.T) {
+	freq, err := LoadFrequencies(strings.NewReader("# word count\n的 1000\n我 500\n是 400\n图书馆 2\n"))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+
+	// 我 是 的 图书馆 are known, 猫 is not: five words, seven characters
+	res, err := Analyse("我是猫的图书馆。", "我\n是\n的\n图书馆")
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+
+	tests := []struct {
+		scorer Scorer
+		want   float64
+	}{
+		{RuneCoverage{}, 600.0 / 7},
+		{TokenCoverage{}, 80},
+		{CoverageThreshold{Threshold: 98, Floor: 70}, 1000.0 / 28},
+		{CoverageThreshold{Threshold: 80, Floor: 70}, 100},
+		{CoverageThreshold{Coverage: RuneCoverage{}, Threshold: 98, Floor: 90}, 0},
+	}
+	for _, tc := range tests {
+		if got := tc.scorer.Score(res); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("%s %v: want %v, got %v", tc.scorer.Name(), tc.scorer.Params(), tc.want, got)
+		}
+	}
+
+	// missing the rare 猫 should cost more than missing the common 的
+	fw := FrequencyWeighted{Frequencies: freq}
+	rare, _ := Analyse("我是猫", "我\n是")
+	common, _ := Analyse("我是的", "我\n是")
+	if fw.Score(rare) >= fw.Score(common) {
+		t.Errorf("unexpected frequency weighted scores: rare %v, common %v", fw.Score(rare), fw.Score(common))
+	}
+}
+
+func TestScoringOptions(t *testing.T) {
+	s, err := ScoringOptions{Model: "coverage-threshold"}.Scorer(nil)
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	if want := map[string]float64{"threshold": 98, "floor": 90}; !reflect.DeepEqual(s.Params(), want) {
+		t.Errorf("unexpected params: want %v, got %v", want, s.Params())
+	}
+
+	zero, high, above := 0.0, 99.0, 101.0
+	s, err = ScoringOptions{Model: "coverage-threshold", Floor: &zero}.Scorer(nil)
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	if want := map[string]float64{"threshold": 98, "floor": 0}; !reflect.DeepEqual(s.Params(), want) {
+		t.Errorf("unexpected params: want %v, got %v", want, s.Params())
+	}
+
+	invalid := []ScoringOptions{
+		{Model: "vibes"},
+		{Model: "frequency-weighted"},
+		{Model: "coverage-threshold", Floor: &high},
+		{Model: "coverage-threshold", Threshold: &above},
+		{Model: "coverage-threshold", Threshold: &zero},
+	}
+	for _, o := range invalid {
+		if _, err := o.Scorer(nil); err == nil {
+			t.Errorf("expected an error for %+v", o)
+		}
+	}
+}
+
+const testLevels = `# word level
+我 1
+是 1
+学生 1
+他 1
+老师 1
+的 1
+认真 3
+非常 2
+`
+
+func TestLevels(t *testing.T) {
+	l, err := LoadLevels(strings.NewReader(testLevels))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+
+	tests := []struct {
+		text     string
+		estimate int
+		above    bool
+		dist     []LevelCount
+	}{
+		{"我是学生。他是老师。", 1, false, []LevelCount{{1, 6}, {2, 0}, {3, 0}, {0, 0}}},
+		{"他是非常认真的老师。", 3, false, []LevelCount{{1, 4}, {2, 1}, {3, 1}, {0, 0}}},
+		{"他是博士。", 3, true, []LevelCount{{1, 2}, {2, 0}, {3, 0}, {0, 2}}},
+	}
+
+	for _, tc := range tests {
+		rep := l.Dictionary().Scan(tc.text).Levels(l)
+		if rep.Estimate != tc.estimate || rep.Above != tc.above {
+			t.Errorf("%s: unexpected estimate: want %d (above %v), got %d (above %v)", tc.text, tc.estimate, tc.above, rep.Estimate, rep.Above)
+		}
+		if !reflect.DeepEqual(rep.Distribution, tc.dist) {
+			t.Errorf("%s: unexpected distribution:\n\twant: %v\n\tgot:  %v", tc.text, tc.dist, rep.Distribution)
+		}
+	}
+
+	if _, err := LoadLevels(strings.NewReader("我 one")); err == nil {
+		t.Errorf("expected an error for an invalid level")
+	}
+	if _, err := LoadLevels(strings.NewReader("# no words\n")); err == nil {
+		t.Errorf("expected an error for an empty list")
+	}
+}
+
+func TestPassages(t *testing.T) {
+	text := "我是学生。他说：“你好！”\n\n他是老师吗？是。"
+	res, err := Analyse(text, "我\n是\n学生\n他\n说\n你好")
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+
+	sentences := []Passage{
+		{Text: "我是学生。", Start: 0, End: 5, ByteStart: 0, ByteEnd: 15, Known: 4, Coverage: 100},
+		{Text: "他说：“你好！”\n\n", Start: 5, End: 15, ByteStart: 15, ByteEnd: 41, Known: 4, Coverage: 100},
+		{Text: "他是老师吗？", Start: 15, End: 21, ByteStart: 41, ByteEnd: 59, Known: 2, Unknown: 3, Coverage: 40},
+		{Text: "是。", Start: 21, End: 23, ByteStart: 59, ByteEnd: 65, Known: 1, Coverage: 100},
+	}
+	if got := res.Sentences(); !reflect.DeepEqual(got, sentences) {
+		t.Errorf("unexpected sentences:\n\twant: %+v\n\tgot:  %+v", sentences, got)
+	}
+
+	paragraphs := []Passage{
+		{Text: "我是学生。他说：“你好！”\n\n", Start: 0, End: 15, ByteStart: 0, ByteEnd: 41, Known: 8, Coverage: 100},
+		{Text: "他是老师吗？是。", Start: 15, End: 23, ByteStart: 41, ByteEnd: 65, Known: 3, Unknown: 3, Coverage: 50},
+	}
+	if got := res.Paragraphs(); !reflect.DeepEqual(got, paragraphs) {
+		t.Errorf("unexpected paragraphs:\n\twant: %+v\n\tgot:  %+v", paragraphs, got)
+	}
+
+	for _, p := range append(res.Sentences(), res.Paragraphs()...) {
+		if text[p.ByteStart:p.ByteEnd] != p.Text {
+			t.Errorf("passage offsets do not match text: %q != %q", text[p.ByteStart:p.ByteEnd], p.Text)
+		}
+	}
+
+	// punctuation scored by the policy is held in unknown segments
+	d, err := NewDictionary(strings.NewReader("我\n是"))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	res = d.ScanWith("我是。你是？他是。", Options{Policy: Policy{Han: Score, Punctuation: Score}})
+	sentences = []Passage{
+		{Text: "我是。", Start: 0, End: 3, ByteStart: 0, ByteEnd: 9, Known: 2, Unknown: 1, Coverage: percent(2, 3)},
+		{Text: "你是？", Start: 3, End: 6, ByteStart: 9, ByteEnd: 18, Known: 1, Unknown: 2, Coverage: percent(1, 3)},
+		{Text: "他是。", Start: 6, End: 9, ByteStart: 18, ByteEnd: 27, Known: 1, Unknown: 2, Coverage: percent(1, 3)},
+	}
+	if got := res.Sentences(); !reflect.DeepEqual(got, sentences) {
+		t.Errorf("unexpected sentences with scored punctuation:\n\twant: %+v\n\tgot:  %+v", sentences, got)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		r    rune
+		want Category
+	}{
+		{'字', Han},
+		{'a', Latin},
+		{'é', Latin},
+		{'7', Digit},
+		{'３', FullWidth},
+		{'Ｗ', FullWidth},
+		{'，', Punctuation},
+		{'。', Punctuation},
+		{'!', Punctuation},
+		{'😀', Emoji},
+		{'☀', Emoji},
+		{' ', Other},
+		{'か', Other},
+	}
+
+	for _, tc := range tests {
+		if got := Classify(tc.r); got != tc.want {
+			t.Errorf("unexpected category for %q: want %s, got %s", tc.r, tc.want, got)
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	d, err := NewDictionary(strings.NewReader("我\n有\n买\niPhone\nA4纸"))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	text := "我有2部iPhone，买了３张A4纸和Nokia😀"
+
+	tests := []struct {
+		name    string
+		policy  Policy
+		known   int
+		unknown int
+	}{
+		{"default", nil, 4, 4},
+		{"latin scored", Policy{Han: Score, Latin: Score}, 11, 9},
+		{"digits known", Policy{Han: Score, Digit: AlwaysKnown, FullWidth: AlwaysKnown}, 7, 4},
+		{"everything", Policy{Han: Score, Latin: Score, Digit: Score, FullWidth: Score, Punctuation: Score, Emoji: Score}, 12, 13},
+	}
+
+	for _, tc := range tests {
+		res := d.ScanWith(text, Options{Policy: tc.policy})
+		if res.Known != tc.known || res.Unknown != tc.unknown {
+			t.Errorf("%s: unexpected counts: want %d known, %d unknown, got %d known, %d unknown", tc.name, tc.known, tc.unknown, res.Known, res.Unknown)
+		}
+	}
+
+	// unmatched Latin words are kept whole rather than split into letters
+	res := d.ScanWith(text, Options{Policy: Policy{Han: Score, Latin: Score}})
+	words := res.UnknownWords()
+	if last := words[len(words)-1]; last.Word != "Nokia" {
+		t.Errorf("unexpected unknown word: want Nokia, got %s", last.Word)
+	}
+}
+
+func TestPolicyJSON(t *testing.T) {
+	var p Policy
+	if err := json.Unmarshal([]byte(`{"han":"score","digit":"known","emoji":"ignore"}`), &p); err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	want := Policy{Han: Score, Digit: AlwaysKnown, Emoji: Ignore}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("unexpected policy: want %v, got %v", want, p)
+	}
+
+	if err := json.Unmarshal([]byte(`{"klingon":"score"}`), &p); err == nil {
+		t.Errorf("expected an error for an unknown category")
+	}
+}
+
+func TestScanNoScorableText(t *testing.T) {
+	for _, text := range []string{"", "plain English text", "123, 456!", "   "} {
+		score, markup, err := Scan(text, "一\n二")
+		if err != ErrNoScorableText {
+			t.Errorf("%q: unexpected error: want %v, got %v", text, ErrNoScorableText, err)
+		}
+		if score != 0 {
+			t.Errorf("%q: unexpected score: want 0, got %d", text, score)
+		}
+		if markup != html.EscapeString(text) {
+			t.Errorf("%q: unexpected markup: %q", text, markup)
+		}
+	}
+}
+
+func FuzzScan(f *testing.F) {
+	f.Add("我知道一，二，三，四，和五，八点吧。", "一\n二\n三")
+	f.Add("", "")
+	f.Add("plain English", "")
+	f.Add("我\xff知道", "我\n知道\n\xfe")
+	f.Add("A4纸和😀", "A4纸\r\n和\r\n")
+	f.Add("<b>中文</b> & 中&amp;文", "中文\n<b>\n&")
+	f.Add("中文", "  中文  \n\n\r\n中")
+
+	f.Fuzz(func(t *testing.T, text, known string) {
+		score, markup, scanErr := Scan(text, known)
+		if scanErr != nil && scanErr != ErrNoScorableText {
+			t.Fatalf("unexpected error returned: %s", scanErr)
+		}
+		if score < 0 || score > 100 {
+			t.Fatalf("score out of range: %d", score)
+		}
+
+		// segments hold the original text, including any invalid bytes
+		if got := stripMarkup(markup); got != text {
+			t.Fatalf("unexpected stripped markup: want %q, got %q", text, got)
+		}
+
+		res, err := Analyse(text, known)
+		if err != nil {
+			t.Fatalf("unexpected error returned: %s", err)
+		}
+		for _, s := range res.Segments {
+			if text[s.ByteStart:s.ByteEnd] != s.Text {
+				t.Fatalf("segment offsets do not match text: %q != %q", text[s.ByteStart:s.ByteEnd], s.Text)
+			}
+		}
+		if (scanErr == nil) != res.Scorable() {
+			t.Fatalf("unexpected scorable result: want %v, got %v", scanErr == nil, res.Scorable())
+		}
+
+		l, _ := ParseWordList(strings.NewReader(known))
+		listed := map[string]bool{}
+		for _, w := range l.Words() {
+			listed[string([]rune(w))] = true
+		}
+		for _, s := range res.Segments {
+			if s.Kind == Known && !listed[s.Entry] {
+				t.Fatalf("highlighted word not in known list: %q", s.Entry)
+			}
+		}
+
+		crlf, err := Analyse(text, strings.Replace(known, "\n", "\r\n", -1))
+		if err != nil {
+			t.Fatalf("unexpected error returned: %s", err)
+		}
+		if !reflect.DeepEqual(res, crlf) {
+			t.Fatalf("unexpected result for CRLF word list: want %v, got %v", res, crlf)
+		}
+	})
+}
+
+// StripMarkup removes the tags added by DefaultHTML and unescapes the text.
+func stripMarkup(markup string) string {
+	open, close := DefaultHTML.tags()
+	markup = strings.Replace(markup, open, "", -1)
+	markup = strings.Replace(markup, close, "", -1)
+	return html.UnescapeString(markup)
+}
+
+func TestParseWordList(t *testing.T) {
+	list := "\ufeff# my words\r\n" +
+		"知道\r\n" +
+		"\r\n" +
+		"  中文  \n" +
+		"学习\txuéxí\tto study, to learn\tHSK1\n" +
+		"老师,lǎoshī,\"teacher, instructor\"\n" +
+		"知道\tzhīdao\n" +
+		"\t\n" +
+		"  # indented comment\n" +
+		"朋友"
+
+	l, err := ParseWordList(strings.NewReader(list))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+
+	want := []WordListEntry{
+		{Word: "知道"},
+		{Word: "中文"},
+		{Word: "学习", Meta: []string{"xuéxí", "to study, to learn", "HSK1"}},
+		{Word: "老师", Meta: []string{"lǎoshī", "teacher, instructor"}},
+		{Word: "朋友"},
+	}
+	if got := l.Entries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected entries: want %v, got %v", want, got)
+	}
+
+	meta, ok := l.Dictionary().Metadata("学习")
+	if !ok || !reflect.DeepEqual(meta, want[2].Meta) {
+		t.Errorf("unexpected metadata: want %v, got %v (%v)", want[2].Meta, meta, ok)
+	}
+	if _, ok := l.Dictionary().Metadata("你好"); ok {
+		t.Errorf("unexpected metadata for unlisted word")
+	}
+
+	d, _ := NewDictionary(strings.NewReader(list))
+	if d.Len() != 5 || d.Contains("") || !d.Contains("知道") {
+		t.Errorf("unexpected dictionary: want %d words, got %d", 5, d.Len())
+	}
+}
+
+func FuzzParseWordList(f *testing.F) {
+	f.Add("一\n二\n三")
+	f.Add("")
+	f.Add("一\r\n二\r\n\r\n")
+	f.Add(" 中文 \t\n\xff\n")
+	f.Add("\ufeff# comment\n学习,xuéxí,\"to study, to learn\"\n老师\tlǎoshī")
+	f.Add(strings.Repeat("中", 2000) + "\n文")
+
+	f.Fuzz(func(t *testing.T, list string) {
+		l, err := ParseWordList(strings.NewReader(list))
+		if err != nil {
+			t.Fatalf("unexpected error returned: %s", err)
+		}
+
+		words := l.Words()
+		if len(words) != l.Len() {
+			t.Fatalf("unexpected length: want %d, got %d", len(words), l.Len())
+		}
+		for _, w := range words {
+			if w == "" || w != strings.TrimSpace(w) || strings.ContainsAny(w, "\n\t") {
+				t.Fatalf("word not trimmed: %q", w)
+			}
+			if _, ok := l.Lookup(w); !ok {
+				t.Fatalf("word missing from list: %q", w)
+			}
+		}
+
+		for _, alt := range []string{
+			strings.Replace(list, "\n", "\r\n", -1),
+			"\ufeff" + list,
+		} {
+			al, err := ParseWordList(strings.NewReader(alt))
+			if err != nil {
+				t.Fatalf("unexpected error returned: %s", err)
+			}
+			if !reflect.DeepEqual(l.Entries(), al.Entries()) {
+				t.Fatalf("unexpected entries for %q: want %v, got %v", alt, l.Entries(), al.Entries())
+			}
+		}
+	})
+}
+
+func TestPolicyScorable(t *testing.T) {
+	tests := []struct {
+		text   string
+		policy Policy
+		want   bool
+	}{
+		{"", nil, false},
+		{"plain English", nil, false},
+		{"English 和中文", nil, true},
+		{"plain English", Policy{Latin: Score}, true},
+		{"123", Policy{Digit: AlwaysKnown}, true},
+	}
+
+	for _, tc := range tests {
+		if got := tc.policy.Scorable(tc.text); got != tc.want {
+			t.Errorf("%q %v: want %v, got %v", tc.text, tc.policy, tc.want, got)
+		}
+		res := newTestDictionary(t).ScanWith(tc.text, Options{Policy: tc.policy})
+		if res.Scorable() != tc.want {
+			t.Errorf("%q %v: result scorable: want %v, got %v", tc.text, tc.policy, tc.want, res.Scorable())
+		}
+	}
+}
+
+func newTestDictionary(t *testing.T) *Dictionary {
+	d, err := NewDictionary(strings.NewReader("中文\n和"))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	return d
+}
@@ -0,0 +1,247 @@
+package scanner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Scorer rates how readable a scanned text is on a scale of 0 to 100.
+type Scorer interface {
+	// Name identifies the model, for example in API responses.
+	Name() string
+
+	// Params returns the parameters the model was configured with.
+	Params() map[string]float64
+
+	// Score returns the readability of the result.
+	Score(r Result) float64
+}
+
+// RuneCoverage scores a text by the percentage of runes scored by the scan
+// policy that count as known. Under DefaultPolicy these are the Han
+// characters that are part of a known word. It is the model used by Scan.
+type RuneCoverage struct{}
+
+// Name implements the Scorer interface.
+func (RuneCoverage) Name() string { return "rune-coverage" }
+
+// Params implements the Scorer interface.
+func (RuneCoverage) Params() map[string]float64 { return map[string]float64{} }
+
+// Score implements the Scorer interface.
+func (RuneCoverage) Score(r Result) float64 {
+	return percent(float64(r.Known), float64(r.Known+r.Unknown))
+}
+
+// TokenCoverage scores a text by the percentage of words that are known,
+// so that a long known word counts the same as a single known character.
+type TokenCoverage struct{}
+
+// Name implements the Scorer interface.
+func (TokenCoverage) Name() string { return "token-coverage" }
+
+// Params implements the Scorer interface.
+func (TokenCoverage) Params() map[string]float64 { return map[string]float64{} }
+
+// Score implements the Scorer interface.
+func (TokenCoverage) Score(r Result) float64 {
+	known, total := 0, 0
+	for _, s := range r.Segments {
+		switch s.Kind {
+		case Known:
+			known++
+			total++
+		case Unknown:
+			total++
+		}
+	}
+	return percent(float64(known), float64(total))
+}
+
+// FrequencyWeighted scores a text by word coverage where each word is
+// weighted by its information content, the negative log of its relative
+// frequency. Rare words count for more than common function words such as
+// 的. Words missing from the frequency list are treated as occurring half
+// as often as the rarest word.
+type FrequencyWeighted struct {
+	Frequencies *Frequencies
+}
+
+// Name implements the Scorer interface.
+func (FrequencyWeighted) Name() string { return "frequency-weighted" }
+
+// Params implements the Scorer interface.
+func (f FrequencyWeighted) Params() map[string]float64 {
+	return map[string]float64{"corpus_size": float64(f.Frequencies.total)}
+}
+
+// Score implements the Scorer interface.
+func (f FrequencyWeighted) Score(r Result) float64 {
+	known, total := 0.0, 0.0
+	for _, s := range r.Segments {
+		if s.Kind == NonHan {
+			continue
+		}
+		w := f.Frequencies.weight(s.Text)
+		if s.Kind == Known {
+			known += w
+		}
+		total += w
+	}
+	return percent(known, total)
+}
+
+// CoverageThreshold models comprehension rather than coverage. Reading
+// research suggests that learners need to know around 98% of the words in
+// a text to read it comfortably without help. Texts at or above Threshold
+// coverage score 100, texts at or below Floor score 0, and scores between
+// the two are linear. Coverage is measured by the Coverage scorer, or by
+// TokenCoverage if it is nil.
+type CoverageThreshold struct {
+	Coverage  Scorer
+	Threshold float64
+	Floor     float64
+}
+
+// Name implements the Scorer interface.
+func (CoverageThreshold) Name() string { return "coverage-threshold" }
+
+// Params implements the Scorer interface.
+func (c CoverageThreshold) Params() map[string]float64 {
+	return map[string]float64{"threshold": c.Threshold, "floor": c.Floor}
+}
+
+// Score implements the Scorer interface.
+func (c CoverageThreshold) Score(r Result) float64 {
+	cov := c.Coverage
+	if cov == nil {
+		cov = TokenCoverage{}
+	}
+
+	s := cov.Score(r)
+	switch {
+	case s >= c.Threshold:
+		return 100
+	case s <= c.Floor:
+		return 0
+	}
+	return (s - c.Floor) * 100 / (c.Threshold - c.Floor)
+}
+
+// Percent returns n as a percentage of total, or 0 if total is zero.
+func percent(n, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return n * 100 / total
+}
+
+// Frequencies holds the number of times each word occurs in a reference
+// corpus.
+type Frequencies struct {
+	counts map[string]int
+	total  int
+	min    int
+}
+
+// LoadFrequencies reads a word frequency list. Each line holds a word and
+// its count separated by whitespace. Blank lines and lines starting with #
+// are ignored. It returns an error if a line is malformed or it fails to
+// read from the reader.
+func LoadFrequencies(r io.Reader) (*Frequencies, error) {
+	f := &Frequencies{counts: map[string]int{}}
+
+	s := bufio.NewScanner(r)
+	n := 0
+	for s.Scan() {
+		n++
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("frequencies: line %d: missing count", n)
+		}
+		c, err := strconv.Atoi(fields[1])
+		if err != nil || c <= 0 {
+			return nil, fmt.Errorf("frequencies: line %d: invalid count %q", n, fields[1])
+		}
+
+		f.counts[fields[0]] += c
+		f.total += c
+		if f.min == 0 || c < f.min {
+			f.min = c
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if f.total == 0 {
+		return nil, fmt.Errorf("frequencies: no words")
+	}
+
+	return f, nil
+}
+
+// Weight returns the information content of a word in bits.
+func (f *Frequencies) weight(word string) float64 {
+	c := float64(f.counts[word])
+	if c == 0 {
+		c = float64(f.min) / 2
+	}
+	return -math.Log2(c / float64(f.total))
+}
+
+// ScoringOptions selects a scoring model by name. It is intended to be
+// decoded from an API request. Threshold and Floor only apply to the
+// coverage-threshold model and default to 98 and 90 when they are nil.
+type ScoringOptions struct {
+	Model     string   `json:"model"`
+	Threshold *float64 `json:"threshold,omitempty"`
+	Floor     *float64 `json:"floor,omitempty"`
+}
+
+// Scorer returns the scorer described by the options. An empty model
+// selects RuneCoverage. The frequency-weighted model takes its weights
+// from freq. It returns an error if the model is not recognised, if a
+// frequency weighted model is requested without frequencies, or if the
+// threshold or floor is outside 0 to 100 or the floor is not below the
+// threshold.
+func (o ScoringOptions) Scorer(freq *Frequencies) (Scorer, error) {
+	switch o.Model {
+	case "", "rune-coverage":
+		return RuneCoverage{}, nil
+	case "token-coverage":
+		return TokenCoverage{}, nil
+	case "frequency-weighted":
+		if freq == nil {
+			return nil, fmt.Errorf("scoring model %q requires word frequencies", o.Model)
+		}
+		return FrequencyWeighted{Frequencies: freq}, nil
+	case "coverage-threshold":
+		c := CoverageThreshold{Threshold: 98, Floor: 90}
+		if o.Threshold != nil {
+			c.Threshold = *o.Threshold
+		}
+		if o.Floor != nil {
+			c.Floor = *o.Floor
+		}
+		if c.Threshold < 0 || c.Threshold > 100 {
+			return nil, fmt.Errorf("scoring threshold %v must be between 0 and 100", c.Threshold)
+		}
+		if c.Floor < 0 || c.Floor > 100 {
+			return nil, fmt.Errorf("scoring floor %v must be between 0 and 100", c.Floor)
+		}
+		if c.Floor >= c.Threshold {
+			return nil, fmt.Errorf("scoring floor %v must be below threshold %v", c.Floor, c.Threshold)
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("unknown scoring model: %q", o.Model)
+}
@@ -0,0 +1,202 @@
+package scanner
+
+import "fmt"
+
+// Segmenter selects the strategy used to break text into words.
+type Segmenter int
+
+const (
+	// ForwardMatch takes the longest known word at each position, working
+	// from the start of the text.
+	ForwardMatch Segmenter = iota
+
+	// BackwardMatch takes the longest known word ending at each position,
+	// working from the end of the text.
+	BackwardMatch
+
+	// BidirectionalMatch runs both forward and backward matching and picks
+	// the segmentation with fewer words, then fewer single characters. Ties
+	// go to backward matching, which is more often correct for Chinese. The
+	// choice is made separately for each run of text between points that
+	// no known or lexicon word crosses.
+	BidirectionalMatch
+)
+
+var segmenterNames = map[Segmenter]string{
+	ForwardMatch:       "forward",
+	BackwardMatch:      "backward",
+	BidirectionalMatch: "bidirectional",
+}
+
+// ParseSegmenter returns the segmenter with the given name. An empty name
+// selects ForwardMatch. It returns an error if the name is not recognised.
+func ParseSegmenter(name string) (Segmenter, error) {
+	if name == "" {
+		return ForwardMatch, nil
+	}
+	for s, n := range segmenterNames {
+		if n == name {
+			return s, nil
+		}
+	}
+	return ForwardMatch, fmt.Errorf("unknown segmenter: %q", name)
+}
+
+// String returns the name of the segmenter.
+func (s Segmenter) String() string {
+	if n, ok := segmenterNames[s]; ok {
+		return n
+	}
+	return "invalid"
+}
+
+// MarshalText allows a Segmenter to be encoded by name.
+func (s Segmenter) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText allows a Segmenter to be decoded by name.
+func (s *Segmenter) UnmarshalText(b []byte) error {
+	v, err := ParseSegmenter(string(b))
+	if err != nil {
+		return err
+	}
+	*s = v
+	return nil
+}
+
+// span is a run of runes [start, end) produced by segmentation. Known
+// spans matched a word in the known list. Other spans are either a word
+// from the lexicon, a run of Latin letters or digits, or a single rune.
+type span struct {
+	start, end int
+	known      bool
+}
+
+// Segment breaks rs into spans using the given strategy. If lex is not nil
+// its words are also used to find word boundaries, except where a lexicon
+// word is made up entirely of known words, which are kept instead.
+func (d *Dictionary) segment(rs []rune, s Segmenter, lex *Lexicon) []span {
+	switch s {
+	case BackwardMatch:
+		return d.backward(rs, lex)
+	case BidirectionalMatch:
+		tries := []*trie{&d.words}
+		if lex != nil {
+			tries = append(tries, &lex.words)
+		}
+
+		// choose separately for each run, so that an ambiguity in one
+		// clause is not decided by the words in the rest of the text
+		spans := make([]span, 0, len(rs)/2)
+		start := 0
+		for _, end := range breaks(rs, tries) {
+			for _, sp := range d.bidirectional(rs[start:end], lex) {
+				spans = append(spans, span{start: start + sp.start, end: start + sp.end, known: sp.known})
+			}
+			start = end
+		}
+		return spans
+	}
+	return d.forward(rs, lex)
+}
+
+// Bidirectional runs both forward and backward matching over rs and
+// returns the segmentation with fewer words, then fewer single runes.
+func (d *Dictionary) bidirectional(rs []rune, lex *Lexicon) []span {
+	f, b := d.forward(rs, lex), d.backward(rs, lex)
+	if len(f) != len(b) {
+		if len(f) < len(b) {
+			return f
+		}
+		return b
+	}
+	if singles(f) < singles(b) {
+		return f
+	}
+	return b
+}
+
+// Breaks returns the positions in rs, in order and ending with len(rs), at
+// which the text can be split without splitting a word in any of the tries
+// or a run of letters or digits. Forward and backward matching give the
+// same spans over the whole text as over each run between breaks.
+func breaks(rs []rune, tries []*trie) []int {
+	var bs []int
+	reach := 0
+	for i := range rs {
+		for _, t := range tries {
+			if l := t.longest(rs[i:]); i+l > reach {
+				reach = i + l
+			}
+		}
+		k := i + 1
+		if k == len(rs) || reach <= k && !(isWordRune(rs[i]) && isWordRune(rs[k])) {
+			bs = append(bs, k)
+		}
+	}
+	return bs
+}
+
+func (d *Dictionary) forward(rs []rune, lex *Lexicon) []span {
+	spans := make([]span, 0, len(rs)/2)
+	for i := 0; i < len(rs); {
+		l := d.words.longest(rs[i:])
+		sp := span{start: i, end: i + l, known: l > 0}
+
+		if lex != nil {
+			if ll := lex.words.longest(rs[i:]); ll > l && !d.words.covers(rs[i:i+ll]) {
+				sp = span{start: i, end: i + ll}
+			}
+		}
+		if sp.end == i {
+			sp.end = i + 1
+			for isWordRune(rs[i]) && sp.end < len(rs) && isWordRune(rs[sp.end]) {
+				sp.end++
+			}
+		}
+
+		spans = append(spans, sp)
+		i = sp.end
+	}
+	return spans
+}
+
+func (d *Dictionary) backward(rs []rune, lex *Lexicon) []span {
+	spans := make([]span, 0, len(rs)/2)
+	for i := len(rs); i > 0; {
+		l := d.rwords.longestSuffix(rs[:i])
+		sp := span{start: i - l, end: i, known: l > 0}
+
+		if lex != nil {
+			if ll := lex.rwords.longestSuffix(rs[:i]); ll > l && !d.words.covers(rs[i-ll:i]) {
+				sp = span{start: i - ll, end: i}
+			}
+		}
+		if sp.start == i {
+			sp.start = i - 1
+			for isWordRune(rs[i-1]) && sp.start > 0 && isWordRune(rs[sp.start-1]) {
+				sp.start--
+			}
+		}
+
+		spans = append(spans, sp)
+		i = sp.start
+	}
+
+	for i, j := 0, len(spans)-1; i < j; i, j = i+1, j-1 {
+		spans[i], spans[j] = spans[j], spans[i]
+	}
+	return spans
+}
+
+// Singles returns the number of single rune spans.
+func singles(spans []span) int {
+	n := 0
+	for _, s := range spans {
+		if s.end-s.start == 1 {
+			n++
+		}
+	}
+	return n
+}
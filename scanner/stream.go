@@ -0,0 +1,142 @@
+package scanner
+
+import (
+	"bufio"
+	"io"
+	"unicode/utf8"
+)
+
+// streamChunk is the number of runes that Stream aims to scan at a time.
+const streamChunk = 4096
+
+// Stream scans text read from r and writes markup to w as it goes, using
+// the given renderer. Text is read and scanned in chunks that are cut
+// where no known word, lexicon word, conversion or run of letters or
+// digits spans the cut. BidirectionalMatch chooses a direction for each
+// run between such points, so the result matches a scan of the whole text
+// with any segmenter while memory use stays constant
+// regardless of the length of the input. Invalid UTF-8 is kept byte for
+// byte, as it is by ScanWith. A ContinuedRenderer is given the last
+// segment of the chunk before, so that it renders each chunk as it would
+// the whole text. The returned Result holds the character counts but no
+// segments. It returns an error if it fails to read, or if rendering
+// fails.
+func (d *Dictionary) Stream(w io.Writer, r io.Reader, rend Renderer, opts Options) (Result, error) {
+	var res Result
+
+	br := bufio.NewReader(r)
+	buf := make([]rune, 0, streamChunk*2)
+	sizes := make([]int, 0, streamChunk*2)
+	var raw []byte
+	var prev Segment
+	start, bytes := 0, 0
+
+	flush := func(n int) error {
+		size := 0
+		for _, sz := range sizes[:n] {
+			size += sz
+		}
+
+		chunk := d.ScanWith(string(raw[:size]), opts)
+		for i := range chunk.Segments {
+			s := &chunk.Segments[i]
+			s.Start, s.End = s.Start+start, s.End+start
+			s.ByteStart, s.ByteEnd = s.ByteStart+bytes, s.ByteEnd+bytes
+		}
+
+		var err error
+		if cr, ok := rend.(ContinuedRenderer); ok && start > 0 {
+			err = cr.RenderAfter(w, prev, chunk.Segments)
+		} else {
+			err = rend.Render(w, chunk.Segments)
+		}
+		if err != nil {
+			return err
+		}
+		if len(chunk.Segments) > 0 {
+			prev = chunk.Segments[len(chunk.Segments)-1]
+		}
+
+		res.Known += chunk.Known
+		res.Unknown += chunk.Unknown
+		start += n
+		bytes += size
+		buf = append(buf[:0], buf[n:]...)
+		sizes = append(sizes[:0], sizes[n:]...)
+		raw = append(raw[:0], raw[size:]...)
+		return nil
+	}
+
+	for {
+		p, err := br.Peek(utf8.UTFMax)
+		if err != nil && err != io.EOF {
+			return res, err
+		}
+		if len(p) == 0 {
+			break
+		}
+
+		// invalid bytes are read one at a time, as utf8.RuneError
+		c, size := utf8.DecodeRune(p)
+		buf = append(buf, c)
+		sizes = append(sizes, size)
+		raw = append(raw, p[:size]...)
+		br.Discard(size)
+
+		if len(buf) < streamChunk+d.lookahead(opts) {
+			continue
+		}
+		if err := flush(d.cut(buf, opts)); err != nil {
+			return res, err
+		}
+	}
+
+	if len(buf) > 0 {
+		if err := flush(len(buf)); err != nil {
+			return res, err
+		}
+	}
+
+	return res, nil
+}
+
+// Lookahead returns the length of the longest word or conversion that
+// could be matched with the given options.
+func (d *Dictionary) lookahead(opts Options) int {
+	n := d.words.depth
+	if opts.Lexicon != nil && opts.Lexicon.words.depth > n {
+		n = opts.Lexicon.words.depth
+	}
+	if opts.Converter != nil && opts.Converter.from.depth > n {
+		n = opts.Converter.from.depth
+	}
+	return n
+}
+
+// Cut returns the last position in buf, at most streamChunk runes in,
+// where no word, conversion or run of letters or digits spans the
+// boundary. If there is no such position,
+// as may happen with pathological input, it cuts at streamChunk.
+func (d *Dictionary) cut(buf []rune, opts Options) int {
+	tries := []*trie{&d.words}
+	rs := buf
+	if opts.Converter != nil {
+		tries = []*trie{&d.normalise(opts.Converter).words, &opts.Converter.from}
+		rs = opts.Converter.convert(buf)
+	}
+	if opts.Lexicon != nil {
+		tries = append(tries, &opts.Lexicon.words)
+	}
+
+	k := 0
+	for _, b := range breaks(rs, tries) {
+		if b > streamChunk {
+			break
+		}
+		k = b
+	}
+	if k == 0 {
+		return streamChunk
+	}
+	return k
+}
@@ -0,0 +1,109 @@
+package scanner
+
+// trie is a prefix tree of words keyed by rune. It allows the longest
+// known word at a position to be found in a single walk over the text,
+// rather than a map lookup for every candidate length.
+type trie struct {
+	root  trieNode
+	depth int
+}
+
+type trieNode struct {
+	children map[rune]*trieNode
+	word     bool
+}
+
+// Insert adds a word to the trie. Empty words are ignored.
+func (t *trie) insert(rs []rune) {
+	if len(rs) == 0 {
+		return
+	}
+
+	n := &t.root
+	for _, r := range rs {
+		c := n.children[r]
+		if c == nil {
+			c = &trieNode{}
+			if n.children == nil {
+				n.children = map[rune]*trieNode{}
+			}
+			n.children[r] = c
+		}
+		n = c
+	}
+	n.word = true
+
+	if len(rs) > t.depth {
+		t.depth = len(rs)
+	}
+}
+
+// Longest returns the length in runes of the longest word in the trie
+// that is a prefix of rs. It returns 0 if there is no such word.
+func (t *trie) longest(rs []rune) int {
+	n := &t.root
+	l := 0
+	for i, r := range rs {
+		n = n.children[r]
+		if n == nil {
+			break
+		}
+		if n.word {
+			l = i + 1
+		}
+	}
+	return l
+}
+
+// Covers reports whether rs can be split into words in the trie, taking
+// the longest word at each position from the start.
+func (t *trie) covers(rs []rune) bool {
+	for i := 0; i < len(rs); {
+		l := t.longest(rs[i:])
+		if l == 0 {
+			return false
+		}
+		i += l
+	}
+	return true
+}
+
+// Contains reports whether rs is a word in the trie.
+func (t *trie) contains(rs []rune) bool {
+	n := &t.root
+	for _, r := range rs {
+		n = n.children[r]
+		if n == nil {
+			return false
+		}
+	}
+	return n.word
+}
+
+// InsertReversed adds a word to the trie back to front, for use with
+// longestSuffix.
+func (t *trie) insertReversed(rs []rune) {
+	rev := make([]rune, len(rs))
+	for i, r := range rs {
+		rev[len(rs)-1-i] = r
+	}
+	t.insert(rev)
+}
+
+// LongestSuffix returns the length in runes of the longest word that is a
+// suffix of rs, where the trie was built with insertReversed. It returns 0
+// if there is no such word.
+func (t *trie) longestSuffix(rs []rune) int {
+	n := &t.root
+	l := 0
+	for i := len(rs) - 1; i >= 0; i-- {
+		n = n.children[rs[i]]
+		if n == nil {
+			break
+		}
+		if n.word {
+			l = len(rs) - i
+		}
+	}
+	return l
+}
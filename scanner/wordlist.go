@@ -0,0 +1,135 @@
+package scanner
+
+import (
+	"bufio"
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+// WordListEntry is a word from a word list along with any further columns
+// from its line, such as pinyin, a meaning or tags.
+type WordListEntry struct {
+	Word string   `json:"word"`
+	Meta []string `json:"meta,omitempty"`
+}
+
+// WordList is a parsed list of known words in the order they were first
+// listed.
+type WordList struct {
+	entries []WordListEntry
+	index   map[string]int
+}
+
+// ParseWordList reads a list of known words, one per line. Blank lines and
+// lines starting with # are skipped, as is a byte order mark. A line may
+// hold several columns separated by tabs or commas, in which case the first
+// column is the word and the rest are kept as metadata. Comma separated
+// lines may quote their fields, but a quoted field may not span lines. A
+// word listed more than once keeps the metadata from its first line. It
+// returns an error if it fails to read from the reader.
+func ParseWordList(r io.Reader) (*WordList, error) {
+	l := &WordList{index: map[string]int{}}
+
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		l.parseLine(line)
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return l, nil
+}
+
+// ParseLine adds the word on a line to the list, if it holds one.
+func (l *WordList) parseLine(line string) {
+	line = strings.TrimSpace(strings.TrimLeft(line, "\ufeff"))
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+
+	fields := splitColumns(line)
+	word := fields[0]
+	if word == "" {
+		return
+	}
+	if _, ok := l.index[word]; ok {
+		return
+	}
+
+	var meta []string
+	if len(fields) > 1 {
+		meta = fields[1:]
+	}
+	l.index[word] = len(l.entries)
+	l.entries = append(l.entries, WordListEntry{Word: word, Meta: meta})
+}
+
+// SplitColumns breaks a line into trimmed columns. Tabs take precedence
+// over commas so that a tab separated meaning may contain commas.
+func splitColumns(line string) []string {
+	var fields []string
+	switch {
+	case strings.Contains(line, "\t"):
+		fields = strings.Split(line, "\t")
+	case strings.Contains(line, ","):
+		cr := csv.NewReader(strings.NewReader(line))
+		cr.FieldsPerRecord = -1
+		cr.LazyQuotes = true
+		rec, err := cr.Read()
+		if err != nil {
+			rec = strings.Split(line, ",")
+		}
+		fields = rec
+	default:
+		return []string{line}
+	}
+
+	for i, f := range fields {
+		fields[i] = strings.TrimSpace(f)
+	}
+	return fields
+}
+
+// Len returns the number of words in the list.
+func (l *WordList) Len() int {
+	return len(l.entries)
+}
+
+// Words returns the words in the list in the order they were first listed.
+func (l *WordList) Words() []string {
+	words := make([]string, len(l.entries))
+	for i, e := range l.entries {
+		words[i] = e.Word
+	}
+	return words
+}
+
+// Entries returns the words in the list along with their metadata.
+func (l *WordList) Entries() []WordListEntry {
+	return append([]WordListEntry(nil), l.entries...)
+}
+
+// Dictionary returns the words in the list as a Dictionary ready for
+// scanning. Metadata is available from the Dictionary.
+func (l *WordList) Dictionary() *Dictionary {
+	d := newDictionary(l.Words())
+	d.meta = l
+	return d
+}
+
+// Lookup returns the metadata for a word and whether the word is listed.
+func (l *WordList) Lookup(word string) ([]string, bool) {
+	i, ok := l.index[word]
+	if !ok {
+		return nil, false
+	}
+	return l.entries[i].Meta, true
+}
@@ -0,0 +1,34 @@
+package scanner
+
+import "sort"
+
+// WordCount is a word and the number of times it occurs in a text.
+type WordCount struct {
+	Word  string `json:"word"`
+	Count int    `json:"count"`
+}
+
+// UnknownWords returns each distinct unknown word or character in the
+// result with the number of times it occurs. The most frequent words come
+// first, and words with the same count are kept in order of appearance.
+func (r Result) UnknownWords() []WordCount {
+	index := map[string]int{}
+	var words []WordCount
+
+	for _, s := range r.Segments {
+		if s.Kind != Unknown {
+			continue
+		}
+		if i, ok := index[s.Text]; ok {
+			words[i].Count++
+			continue
+		}
+		index[s.Text] = len(words)
+		words = append(words, WordCount{Word: s.Text, Count: 1})
+	}
+
+	sort.SliceStable(words, func(i, j int) bool {
+		return words[i].Count > words[j].Count
+	})
+	return words
+}
@@ -0,0 +1,26 @@
+//go:build appengine
+// +build appengine
+
+package token
+
+import (
+	"net/http"
+
+	"github.com/billglover/chinese-reader/internal/logging"
+	"github.com/billglover/uid"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/urlfetch"
+)
+
+func init() {
+	s := &Server{
+		Store: DatastoreStore{},
+		// We use a custom client because App Engine
+		// does not allow outbound requests otherwise
+		Charger: StripeCharger{Key: StripeKey, Client: urlfetch.Client},
+		NewID:   uid.NextStringID,
+		Context: appengine.NewContext,
+		Logger:  logging.AppEngine{},
+	}
+	http.Handle("/", s.Router())
+}
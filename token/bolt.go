@@ -0,0 +1,96 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var tokenBucket = []byte("tokens")
+
+// BoltStore keeps tokens in a BoltDB file, so that the service can run on
+// a single machine without the App Engine datastore.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens the BoltDB file at path, creating it if needed. The
+// store must be closed when it is no longer needed.
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(tokenBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+// Close closes the underlying BoltDB file.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// Get implements the TokenStore interface.
+func (s *BoltStore) Get(ctx context.Context, id string) (Token, error) {
+	var t Token
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(tokenBucket).Get([]byte(id))
+		if b == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(b, &t)
+	})
+	return t, err
+}
+
+// Put implements the TokenStore interface.
+func (s *BoltStore) Put(ctx context.Context, t Token) error {
+	t.Valid = false
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(tokenBucket).Put([]byte(t.ID), b)
+	})
+}
+
+// Use implements the TokenStore interface. The token is read and written
+// back within a single BoltDB transaction.
+func (s *BoltStore) Use(ctx context.Context, id string) (Token, error) {
+	var t Token
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(tokenBucket)
+		b := bucket.Get([]byte(id))
+		if b == nil {
+			return ErrNotFound
+		}
+		if err := json.Unmarshal(b, &t); err != nil {
+			return err
+		}
+		if err := t.use(); err != nil {
+			return err
+		}
+
+		stored := t
+		stored.Valid = false
+		b, err := json.Marshal(stored)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(id), b)
+	})
+	return t, err
+}
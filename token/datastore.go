@@ -0,0 +1,64 @@
+//go:build appengine
+// +build appengine
+
+package token
+
+import (
+	"context"
+
+	"google.golang.org/appengine/datastore"
+)
+
+// tokenKind is the datastore kind under which tokens are kept.
+const tokenKind = "tokens"
+
+// DatastoreStore keeps tokens in the App Engine datastore.
+type DatastoreStore struct{}
+
+// Get implements the TokenStore interface.
+func (DatastoreStore) Get(ctx context.Context, id string) (Token, error) {
+	var t Token
+	tokenKey := datastore.NewKey(ctx, tokenKind, id, 0, nil)
+	err := datastore.Get(ctx, tokenKey, &t)
+	if err == datastore.ErrNoSuchEntity {
+		return t, ErrNotFound
+	}
+	return t, err
+}
+
+// Put implements the TokenStore interface.
+func (DatastoreStore) Put(ctx context.Context, t Token) error {
+	tokenKey := datastore.NewKey(ctx, tokenKind, t.ID, 0, nil)
+	_, err := datastore.Put(ctx, tokenKey, &t)
+	return err
+}
+
+// useAttempts is the number of times a transaction using a token is tried
+// before giving up, as concurrent uses of one token conflict.
+const useAttempts = 10
+
+// Use implements the TokenStore interface. The token is read and written
+// back within a datastore transaction, which is retried if another use of
+// the token commits first.
+func (DatastoreStore) Use(ctx context.Context, id string) (Token, error) {
+	var t Token
+	tokenKey := datastore.NewKey(ctx, tokenKind, id, 0, nil)
+
+	err := datastore.RunInTransaction(ctx, func(tc context.Context) error {
+		t = Token{}
+		err := datastore.Get(tc, tokenKey, &t)
+		if err == datastore.ErrNoSuchEntity {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := t.use(); err != nil {
+			return err
+		}
+
+		_, err = datastore.Put(tc, tokenKey, &t)
+		return err
+	}, &datastore.TransactionOptions{Attempts: useAttempts})
+	return t, err
+}
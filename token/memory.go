@@ -0,0 +1,58 @@
+package token
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryStore keeps tokens in memory.
+type MemoryStore struct {
+	mu     sync.Mutex
+	tokens map[string]Token
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tokens: map[string]Token{}}
+}
+
+// Get implements the TokenStore interface.
+func (s *MemoryStore) Get(ctx context.Context, id string) (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[id]
+	if !ok {
+		return Token{}, ErrNotFound
+	}
+	return t, nil
+}
+
+// Put implements the TokenStore interface.
+func (s *MemoryStore) Put(ctx context.Context, t Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t.Valid = false
+	s.tokens[t.ID] = t
+	return nil
+}
+
+// Use implements the TokenStore interface.
+func (s *MemoryStore) Use(ctx context.Context, id string) (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[id]
+	if !ok {
+		return Token{}, ErrNotFound
+	}
+	if err := t.use(); err != nil {
+		return t, err
+	}
+
+	stored := t
+	stored.Valid = false
+	s.tokens[id] = stored
+	return t, nil
+}
@@ -0,0 +1,45 @@
+package token
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotFound is returned by a TokenStore when there is no token with the
+// requested id.
+var ErrNotFound = errors.New("token not found")
+
+// ErrInvalid is returned by a TokenStore when asked to use a token that has
+// expired or has no remaining uses.
+var ErrInvalid = errors.New("token is not valid")
+
+// TokenStore keeps tokens by id. Implementations must be safe for
+// concurrent use.
+type TokenStore interface {
+	// Get returns the token with the given id.
+	Get(ctx context.Context, id string) (Token, error)
+
+	// Put creates or replaces a token.
+	Put(ctx context.Context, t Token) error
+
+	// Use atomically takes one use from a token and returns the updated
+	// token. If the token is not valid it is returned unchanged along with
+	// ErrInvalid.
+	Use(ctx context.Context, id string) (Token, error)
+}
+
+// Use takes one use from a valid token. It returns ErrInvalid, leaving the
+// token unchanged, if the token has expired or has no remaining uses.
+func (t *Token) use() error {
+	t.Valid = t.IsValid()
+	if !t.Valid {
+		return ErrInvalid
+	}
+
+	// reduce the number of remaining uses but cap at 0
+	t.Remaining--
+	if t.Remaining < 0 {
+		t.Remaining = 0
+	}
+	return nil
+}
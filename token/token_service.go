@@ -8,15 +8,11 @@ import (
 	"net/http"
 	"time"
 
-	"google.golang.org/appengine"
-
+	"github.com/billglover/chinese-reader/internal/logging"
 	"github.com/billglover/uid"
 	"github.com/gorilla/mux"
 	stripe "github.com/stripe/stripe-go"
 	"github.com/stripe/stripe-go/client"
-	"google.golang.org/appengine/datastore"
-	"google.golang.org/appengine/log"
-	"google.golang.org/appengine/urlfetch"
 )
 
 const (
@@ -50,12 +46,43 @@ type RequestToken struct {
 	ID string `json:"id"`
 }
 
-func init() {
+// Charger takes payment for a new token.
+type Charger interface {
+	Charge(ctx context.Context, cardToken, email, orderID string) error
+}
+
+// Server handles requests to the token service. Tokens are kept in Store
+// and paid for through Charger. NewID generates the ids of new tokens,
+// Context returns the context for a request and Logger records what the
+// server is doing.
+type Server struct {
+	Store   TokenStore
+	Charger Charger
+	NewID   func() (string, error)
+	Context func(*http.Request) context.Context
+	Logger  logging.Logger
+}
+
+// NewServer returns a Server that keeps tokens in store and charges for
+// them through charger, using the request context and the standard
+// library logger.
+func NewServer(store TokenStore, charger Charger) *Server {
+	return &Server{
+		Store:   store,
+		Charger: charger,
+		NewID:   uid.NextStringID,
+		Context: (*http.Request).Context,
+		Logger:  logging.Std,
+	}
+}
+
+// Router returns a handler that routes requests to the token service.
+func (s *Server) Router() http.Handler {
 	r := mux.NewRouter()
-	r.HandleFunc("/token", PostTokenHandler).Methods("POST")
-	r.HandleFunc("/token/{id}", GetTokenHandler).Methods("GET")
-	r.HandleFunc("/token/{id}", PatchTokenHandler).Methods("PATCH")
-	http.Handle("/", r)
+	r.HandleFunc("/token", s.PostTokenHandler).Methods("POST")
+	r.HandleFunc("/token/{id}", s.GetTokenHandler).Methods("GET")
+	r.HandleFunc("/token/{id}", s.PatchTokenHandler).Methods("PATCH")
+	return r
 }
 
 // PostTokenHandler handles an HTTP POST request. It creates a new token
@@ -63,12 +90,13 @@ func init() {
 // the constants.
 // TODO: create a response schema
 // TODO: handle errors during payment
-func PostTokenHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := appengine.NewContext(r)
+func (s *Server) PostTokenHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := s.Context(r)
 
-	t, err := createToken(ctx)
+	t, err := s.createToken(ctx)
 	// if token generation fails, return without charging the user
 	if err != nil {
+		s.Logger.Errorf(ctx, "unable to create token: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -76,21 +104,24 @@ func PostTokenHandler(w http.ResponseWriter, r *http.Request) {
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 	defer r.Body.Close()
 
 	var mreq Request
 	err = json.Unmarshal(body, &mreq)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	stripeToken := mreq.Token.ID
 	email := mreq.Email
-	err = chargeUser(ctx, stripeToken, email, t.ID)
+	err = s.Charger.Charge(ctx, stripeToken, email, t.ID)
 	// at this point we need to be very clear to the user whether they
 	// have been charged or not.
 	if err != nil {
+		s.Logger.Errorf(ctx, "unable to charge for token %s: %v", t.ID, err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -101,23 +132,22 @@ func PostTokenHandler(w http.ResponseWriter, r *http.Request) {
 // GetTokenHandler handles an HTTP GET request. It returns the token
 // that corresponds to the ID provided in the path.
 // TODO: get token should be marked as internal only
-func GetTokenHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := appengine.NewContext(r)
-	var t Token
+func (s *Server) GetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := s.Context(r)
 
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	tokenKey := datastore.NewKey(ctx, "tokens", id, 0, nil)
-	if err := datastore.Get(ctx, tokenKey, &t); err != nil {
-		log.Errorf(ctx, "unable to locate token: %v", err)
+	t, err := s.Store.Get(ctx, id)
+	if err != nil {
+		s.Logger.Errorf(ctx, "unable to locate token: %v", err)
 		respondWithError(w, http.StatusNotFound, "unable to locate token")
 		return
 	}
 
 	t.Valid = t.IsValid()
 	if t.Valid == false {
-		log.Infof(ctx, "unable to retrieve invalid token: %s, expired: %s, remaining: %d", t.ID, t.Expires, t.Remaining)
+		s.Logger.Infof(ctx, "unable to retrieve invalid token: %s, expired: %s, remaining: %d", t.ID, t.Expires, t.Remaining)
 		respondWithJSON(w, http.StatusGone, t)
 		return
 	}
@@ -129,49 +159,39 @@ func GetTokenHandler(w http.ResponseWriter, r *http.Request) {
 // counter can only be reduced by 1 on each update. All other update requests are
 // treated as invalid.
 // TODO: patch token should be marked as internal only
-func PatchTokenHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := appengine.NewContext(r)
-	var t Token
+func (s *Server) PatchTokenHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := s.Context(r)
 
 	vars := mux.Vars(r)
 	id := vars["id"]
 
 	action := r.URL.Query().Get("action")
 	if action != "use" {
-		log.Errorf(ctx, "invalid action requested")
+		s.Logger.Errorf(ctx, "invalid action requested")
 		respondWithError(w, http.StatusBadRequest, "invalid action requested")
 		return
 	}
 
-	tokenKey := datastore.NewKey(ctx, "tokens", id, 0, nil)
-	if err := datastore.Get(ctx, tokenKey, &t); err != nil {
-		log.Errorf(ctx, "unable to locate token: %v", err)
+	// the store checks the token is valid and takes a use in one step, so
+	// that concurrent requests cannot spend the same use twice
+	t, err := s.Store.Use(ctx, id)
+	switch err {
+	case nil:
+	case ErrNotFound:
+		s.Logger.Errorf(ctx, "unable to locate token: %v", err)
 		respondWithError(w, http.StatusNotFound, "unable to locate token")
 		return
-	}
-
-	// check the token is valid before any updates are made
-	t.Valid = t.IsValid()
-	if t.Valid == false {
-		log.Infof(ctx, "unable to use invalid token: %s, expired: %s, remaining: %d", t.ID, t.Expires, t.Remaining)
+	case ErrInvalid:
+		s.Logger.Infof(ctx, "unable to use invalid token: %s, expired: %s, remaining: %d", t.ID, t.Expires, t.Remaining)
 		respondWithJSON(w, http.StatusGone, t)
 		return
-	}
-
-	// reduce the number of remaining uses but cap at 0
-	t.Remaining--
-	if t.Remaining < 0 {
-		t.Remaining = 0
-	}
-
-	resultKey, err := datastore.Put(ctx, tokenKey, &t)
-	if err != nil {
-		log.Errorf(ctx, "unable to modify token: %v", err)
+	default:
+		s.Logger.Errorf(ctx, "unable to modify token: %v", err)
 		respondWithError(w, http.StatusInternalServerError, "unable to modify token")
 		return
 	}
 
-	log.Infof(ctx, "used token: %s, remaining: %d", resultKey.StringID(), t.Remaining)
+	s.Logger.Infof(ctx, "used token: %s, remaining: %d", t.ID, t.Remaining)
 	respondWithJSON(w, http.StatusOK, t)
 }
 
@@ -192,10 +212,10 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 }
 
 // CreateToken creates an individual token with default values
-func createToken(ctx context.Context) (Token, error) {
+func (s *Server) createToken(ctx context.Context) (Token, error) {
 	var t Token
 
-	id, err := uid.NextStringID()
+	id, err := s.NewID()
 	if err != nil {
 		return t, err
 	}
@@ -209,9 +229,7 @@ func createToken(ctx context.Context) (Token, error) {
 		Remaining: TokenCount,
 	}
 
-	tokenKey := datastore.NewKey(ctx, "tokens", t.ID, 0, nil)
-	_, err = datastore.Put(ctx, tokenKey, &t)
-	if err != nil {
+	if err := s.Store.Put(ctx, t); err != nil {
 		return t, err
 	}
 
@@ -219,14 +237,21 @@ func createToken(ctx context.Context) (Token, error) {
 	return t, nil
 }
 
-// ChargeUser attempts to charge a users card and indicates whether
-// the charge was successful or not.
-func chargeUser(ctx context.Context, cardToken, email, userToken string) error {
-	stripe.Key = StripeKey
+// StripeCharger charges a user's card through Stripe. Client returns the
+// HTTP client to use for a request, and defaults to http.DefaultClient.
+type StripeCharger struct {
+	Key    string
+	Client func(ctx context.Context) *http.Client
+}
 
-	// We create a custom client because App Engine
-	httpClient := urlfetch.Client(ctx)
-	stripeClient := client.New(stripe.Key, stripe.NewBackends(httpClient))
+// Charge attempts to charge a users card and indicates whether
+// the charge was successful or not.
+func (c StripeCharger) Charge(ctx context.Context, cardToken, email, orderID string) error {
+	httpClient := http.DefaultClient
+	if c.Client != nil {
+		httpClient = c.Client(ctx)
+	}
+	stripeClient := client.New(c.Key, stripe.NewBackends(httpClient))
 
 	// Charge the user's card:
 	params := &stripe.ChargeParams{
@@ -235,7 +260,7 @@ func chargeUser(ctx context.Context, cardToken, email, userToken string) error {
 		Desc:     "Chinese Reader Token",
 		Email:    email,
 	}
-	params.AddMeta("order_id", userToken)
+	params.AddMeta("order_id", orderID)
 	params.SetSource(cardToken)
 
 	// TODO: return more useful charge errors to the caller
@@ -244,11 +269,8 @@ func chargeUser(ctx context.Context, cardToken, email, userToken string) error {
 		return err
 	}
 
-	log.Infof(ctx, "%+v\n", charge)
-
 	if charge.Status != "succeeded" {
-		log.Errorf(ctx, charge.FailMsg)
-		return fmt.Errorf(charge.FailMsg)
+		return fmt.Errorf("%s", charge.FailMsg)
 	}
 
 	return nil
@@ -0,0 +1,238 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/billglover/chinese-reader/internal/logging"
+	"github.com/billglover/chinese-reader/internal/servicetest"
+)
+
+// testCharger records charges and fails them if err is set.
+type testCharger struct {
+	charged []string
+	err     error
+}
+
+func (c *testCharger) Charge(ctx context.Context, cardToken, email, orderID string) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.charged = append(c.charged, orderID)
+	return nil
+}
+
+func newTestServer(t *testing.T) (*Server, *MemoryStore, *testCharger) {
+	store := NewMemoryStore()
+	charger := &testCharger{}
+	s := NewServer(store, charger)
+	s.NewID = func() (string, error) { return "abc", nil }
+	s.Logger = logging.Func(t.Logf)
+	return s, store, charger
+}
+
+func decodeToken(t *testing.T, rw *httptest.ResponseRecorder) Token {
+	var tok Token
+	if err := json.Unmarshal(rw.Body.Bytes(), &tok); err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	return tok
+}
+
+func TestPostTokenHandler(t *testing.T) {
+	s, store, charger := newTestServer(t)
+
+	body := `{"token": {"id": "tok_visa"}, "email": "reader@example.com"}`
+	rw := servicetest.Serve(s.Router(), httptest.NewRequest("POST", "/token", strings.NewReader(body)))
+	if rw.Code != http.StatusCreated {
+		t.Fatalf("unexpected status: want %d, got %d", http.StatusCreated, rw.Code)
+	}
+
+	tok := decodeToken(t, rw)
+	if tok.ID != "abc" || tok.Remaining != TokenCount || !tok.Valid {
+		t.Errorf("unexpected token: %+v", tok)
+	}
+	if len(charger.charged) != 1 || charger.charged[0] != "abc" {
+		t.Errorf("unexpected charges: want %v, got %v", []string{"abc"}, charger.charged)
+	}
+	if _, err := store.Get(context.Background(), "abc"); err != nil {
+		t.Errorf("unexpected error returned: %s", err)
+	}
+
+	rw = servicetest.Serve(s.Router(), httptest.NewRequest("POST", "/token", strings.NewReader("{")))
+	if rw.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusBadRequest, rw.Code)
+	}
+
+	charger.err = errors.New("card declined")
+	rw = servicetest.Serve(s.Router(), httptest.NewRequest("POST", "/token", strings.NewReader(body)))
+	if rw.Code != http.StatusInternalServerError {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusInternalServerError, rw.Code)
+	}
+}
+
+func TestGetTokenHandler(t *testing.T) {
+	s, store, _ := newTestServer(t)
+
+	ctx := context.Background()
+	store.Put(ctx, Token{ID: "abc", Expires: time.Now().Add(time.Hour), Remaining: 10})
+	store.Put(ctx, Token{ID: "old", Expires: time.Now().Add(-time.Hour), Remaining: 10})
+	store.Put(ctx, Token{ID: "used", Expires: time.Now().Add(time.Hour), Remaining: 0})
+
+	tests := []struct {
+		id   string
+		code int
+	}{
+		{"abc", http.StatusOK},
+		{"old", http.StatusGone},
+		{"used", http.StatusGone},
+		{"xyz", http.StatusNotFound},
+	}
+
+	for _, tc := range tests {
+		rw := servicetest.Serve(s.Router(), httptest.NewRequest("GET", "/token/"+tc.id, nil))
+		if rw.Code != tc.code {
+			t.Errorf("%s: unexpected status: want %d, got %d", tc.id, tc.code, rw.Code)
+		}
+	}
+}
+
+func TestPatchTokenHandler(t *testing.T) {
+	s, store, _ := newTestServer(t)
+
+	ctx := context.Background()
+	store.Put(ctx, Token{ID: "abc", Expires: time.Now().Add(time.Hour), Remaining: 2})
+
+	tests := []struct {
+		url       string
+		code      int
+		remaining int
+	}{
+		{"/token/abc?action=renew", http.StatusBadRequest, 2},
+		{"/token/xyz?action=use", http.StatusNotFound, 2},
+		{"/token/abc?action=use", http.StatusOK, 1},
+		{"/token/abc?action=use", http.StatusOK, 0},
+		{"/token/abc?action=use", http.StatusGone, 0},
+	}
+
+	for _, tc := range tests {
+		rw := servicetest.Serve(s.Router(), httptest.NewRequest("PATCH", tc.url, nil))
+		if rw.Code != tc.code {
+			t.Errorf("%s: unexpected status: want %d, got %d", tc.url, tc.code, rw.Code)
+		}
+
+		tok, err := store.Get(ctx, "abc")
+		if err != nil {
+			t.Fatalf("unexpected error returned: %s", err)
+		}
+		if tok.Remaining != tc.remaining {
+			t.Errorf("%s: unexpected remaining uses: want %d, got %d", tc.url, tc.remaining, tok.Remaining)
+		}
+	}
+}
+
+func TestStores(t *testing.T) {
+	bs, err := NewBoltStore(filepath.Join(t.TempDir(), "tokens.db"))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	defer bs.Close()
+
+	stores := map[string]TokenStore{
+		"memory": NewMemoryStore(),
+		"bolt":   bs,
+	}
+
+	ctx := context.Background()
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	for name, store := range stores {
+		if _, err := store.Get(ctx, "abc"); err != ErrNotFound {
+			t.Errorf("%s: unexpected error: want %v, got %v", name, ErrNotFound, err)
+		}
+
+		want := Token{ID: "abc", Created: expires.AddDate(-1, 0, 0), Expires: expires, Remaining: 5}
+		if err := store.Put(ctx, want); err != nil {
+			t.Fatalf("%s: unexpected error returned: %s", name, err)
+		}
+		want.Remaining = 4
+		if err := store.Put(ctx, want); err != nil {
+			t.Fatalf("%s: unexpected error returned: %s", name, err)
+		}
+
+		got, err := store.Get(ctx, "abc")
+		if err != nil {
+			t.Fatalf("%s: unexpected error returned: %s", name, err)
+		}
+		if got.ID != want.ID || !got.Created.Equal(want.Created) || !got.Expires.Equal(want.Expires) || got.Remaining != want.Remaining {
+			t.Errorf("%s: unexpected token: want %+v, got %+v", name, want, got)
+		}
+	}
+}
+
+func TestPatchTokenHandlerConcurrent(t *testing.T) {
+	bs, err := NewBoltStore(filepath.Join(t.TempDir(), "tokens.db"))
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	defer bs.Close()
+
+	stores := map[string]TokenStore{
+		"memory": NewMemoryStore(),
+		"bolt":   bs,
+	}
+
+	const requests = 300
+	tests := []struct {
+		remaining int
+		ok        int
+		final     int
+	}{
+		{1000, requests, 1000 - requests},
+		{100, 100, 0},
+	}
+
+	ctx := context.Background()
+	for name, store := range stores {
+		for _, tc := range tests {
+			s := NewServer(store, &testCharger{})
+			s.Logger = logging.Func(t.Logf)
+			store.Put(ctx, Token{ID: "abc", Expires: time.Now().Add(time.Hour), Remaining: tc.remaining})
+
+			codes := make(chan int, requests)
+			var wg sync.WaitGroup
+			for i := 0; i < requests; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					codes <- servicetest.Serve(s.Router(), httptest.NewRequest("PATCH", "/token/abc?action=use", nil)).Code
+				}()
+			}
+			wg.Wait()
+			close(codes)
+
+			counts := map[int]int{}
+			for c := range codes {
+				counts[c]++
+			}
+			if counts[http.StatusOK] != tc.ok || counts[http.StatusGone] != requests-tc.ok {
+				t.Errorf("%s: unexpected responses: want %d ok and %d gone, got %v", name, tc.ok, requests-tc.ok, counts)
+			}
+
+			tok, err := store.Get(ctx, "abc")
+			if err != nil {
+				t.Fatalf("%s: unexpected error returned: %s", name, err)
+			}
+			if tok.Remaining != tc.final {
+				t.Errorf("%s: unexpected remaining uses: want %d, got %d", name, tc.final, tok.Remaining)
+			}
+		}
+	}
+}
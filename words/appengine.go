@@ -0,0 +1,21 @@
+//go:build appengine
+// +build appengine
+
+package words
+
+import (
+	"net/http"
+
+	"github.com/billglover/chinese-reader/internal/logging"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/file"
+)
+
+func init() {
+	s := &Server{
+		Store:   GCSStore{DefaultBucket: file.DefaultBucketName},
+		Context: appengine.NewContext,
+		Logger:  logging.AppEngine{},
+	}
+	http.Handle("/", s.Router())
+}
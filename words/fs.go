@@ -0,0 +1,114 @@
+package words
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// FileStore keeps word lists as files in a local directory, named by id.
+type FileStore struct {
+	Dir string
+}
+
+// NewFileStore returns a FileStore that keeps word lists in dir, creating
+// the directory if it does not exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileStore{Dir: dir}, nil
+}
+
+func (s *FileStore) path(id string) (string, error) {
+	if !validID(id) {
+		return "", ErrInvalidID
+	}
+	return filepath.Join(s.Dir, id), nil
+}
+
+// Get implements the WordListStore interface.
+func (s *FileStore) Get(ctx context.Context, id string) (io.ReadCloser, error) {
+	p, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Put implements the WordListStore interface. The list is written to a
+// temporary file first, so that readers never see a partial list.
+func (s *FileStore) Put(ctx context.Context, id string, r io.Reader) error {
+	p, err := s.path(id)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(s.Dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+// Delete implements the WordListStore interface.
+func (s *FileStore) Delete(ctx context.Context, id string) error {
+	p, err := s.path(id)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(p)
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Exists implements the WordListStore interface.
+func (s *FileStore) Exists(ctx context.Context, id string) (bool, error) {
+	p, err := s.path(id)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(p)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// List implements the WordListStore interface.
+func (s *FileStore) List(ctx context.Context) ([]string, error) {
+	infos, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, fi := range infos {
+		if fi.Mode().IsRegular() && validID(fi.Name()) {
+			ids = append(ids, fi.Name())
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
@@ -0,0 +1,142 @@
+package words
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// GCSStore keeps word lists as objects in a Google Cloud Storage bucket,
+// named by id. If Bucket is empty the bucket is named by DefaultBucket,
+// such as the default bucket of the App Engine application.
+type GCSStore struct {
+	Bucket        string
+	DefaultBucket func(ctx context.Context) (string, error)
+}
+
+// Bucket returns a handle on the bucket along with the client it was made
+// from, which the caller must close.
+func (s GCSStore) bucket(ctx context.Context) (*storage.BucketHandle, *storage.Client, error) {
+	name := s.Bucket
+	if name == "" {
+		if s.DefaultBucket == nil {
+			return nil, nil, errors.New("no bucket set for word lists")
+		}
+
+		var err error
+		name, err = s.DefaultBucket(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client.Bucket(name), client, nil
+}
+
+// objectReader closes the client along with the object it is reading.
+type objectReader struct {
+	*storage.Reader
+	client *storage.Client
+}
+
+func (r objectReader) Close() error {
+	err := r.Reader.Close()
+	r.client.Close()
+	return err
+}
+
+// Get implements the WordListStore interface.
+func (s GCSStore) Get(ctx context.Context, id string) (io.ReadCloser, error) {
+	bucket, client, err := s.bucket(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	objr, err := bucket.Object(id).NewReader(ctx)
+	if err == storage.ErrObjectNotExist {
+		client.Close()
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return objectReader{Reader: objr, client: client}, nil
+}
+
+// Put implements the WordListStore interface.
+func (s GCSStore) Put(ctx context.Context, id string, r io.Reader) error {
+	bucket, client, err := s.bucket(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	objw := bucket.Object(id).NewWriter(ctx)
+	if _, err := io.Copy(objw, r); err != nil {
+		objw.Close()
+		return err
+	}
+	return objw.Close()
+}
+
+// Delete implements the WordListStore interface.
+func (s GCSStore) Delete(ctx context.Context, id string) error {
+	bucket, client, err := s.bucket(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	err = bucket.Object(id).Delete(ctx)
+	if err == storage.ErrObjectNotExist {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Exists implements the WordListStore interface.
+func (s GCSStore) Exists(ctx context.Context, id string) (bool, error) {
+	bucket, client, err := s.bucket(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer client.Close()
+
+	_, err = bucket.Object(id).Attrs(ctx)
+	if err == storage.ErrObjectNotExist {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// List implements the WordListStore interface.
+func (s GCSStore) List(ctx context.Context) ([]string, error) {
+	bucket, client, err := s.bucket(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	var ids []string
+	it := bucket.Objects(ctx, nil)
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, attrs.Name)
+	}
+	return ids, nil
+}
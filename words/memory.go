@@ -0,0 +1,83 @@
+package words
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+// MemoryStore keeps word lists in memory.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	lists map[string][]byte
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{lists: map[string][]byte{}}
+}
+
+// Get implements the WordListStore interface.
+func (s *MemoryStore) Get(ctx context.Context, id string) (io.ReadCloser, error) {
+	s.mu.RLock()
+	b, ok := s.lists[id]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
+// Put implements the WordListStore interface.
+func (s *MemoryStore) Put(ctx context.Context, id string, r io.Reader) error {
+	if id == "" {
+		return ErrInvalidID
+	}
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.lists[id] = b
+	s.mu.Unlock()
+	return nil
+}
+
+// Delete implements the WordListStore interface.
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.lists[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.lists, id)
+	return nil
+}
+
+// Exists implements the WordListStore interface.
+func (s *MemoryStore) Exists(ctx context.Context, id string) (bool, error) {
+	s.mu.RLock()
+	_, ok := s.lists[id]
+	s.mu.RUnlock()
+	return ok, nil
+}
+
+// List implements the WordListStore interface.
+func (s *MemoryStore) List(ctx context.Context) ([]string, error) {
+	s.mu.RLock()
+	ids := make([]string, 0, len(s.lists))
+	for id := range s.lists {
+		ids = append(ids, id)
+	}
+	s.mu.RUnlock()
+
+	sort.Strings(ids)
+	return ids, nil
+}
@@ -0,0 +1,41 @@
+package words
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+// ErrNotFound is returned by a WordListStore when there is no word list
+// with the requested id.
+var ErrNotFound = errors.New("word list not found")
+
+// ErrInvalidID is returned by a WordListStore when an id cannot be used
+// to name a word list.
+var ErrInvalidID = errors.New("invalid word list id")
+
+// WordListStore keeps word lists by id, which is the token of the user the
+// list belongs to. Implementations must be safe for concurrent use.
+type WordListStore interface {
+	// Get returns a reader on a word list. The caller must close it.
+	Get(ctx context.Context, id string) (io.ReadCloser, error)
+
+	// Put creates or replaces a word list with the contents of r.
+	Put(ctx context.Context, id string, r io.Reader) error
+
+	// Delete removes a word list.
+	Delete(ctx context.Context, id string) error
+
+	// Exists reports whether a word list is stored.
+	Exists(ctx context.Context, id string) (bool, error)
+
+	// List returns the ids of all stored word lists.
+	List(ctx context.Context) ([]string, error)
+}
+
+// ValidID reports whether an id is safe to use as the name of a file. Ids
+// starting with a dot are reserved for temporary files.
+func validID(id string) bool {
+	return id != "" && !strings.HasPrefix(id, ".") && !strings.ContainsAny(id, "/\\\x00")
+}
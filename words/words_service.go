@@ -1,33 +1,51 @@
 package words
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 
-	"cloud.google.com/go/storage"
+	"github.com/billglover/chinese-reader/flashcards"
+	"github.com/billglover/chinese-reader/internal/logging"
 	"github.com/gorilla/mux"
-	"google.golang.org/appengine"
-	"google.golang.org/appengine/file"
-	"google.golang.org/appengine/log"
 )
 
-func init() {
-	r := mux.NewRouter()
-	r.HandleFunc("/words", PostWordsHandler).Methods("POST")
-	r.HandleFunc("/words/{id}", GetWordsHandler).Methods("GET")
-	r.HandleFunc("/words/{id}", DeleteWordsHandler).Methods("DELETE")
-	r.HandleFunc("/words/{id}", PutWordsHandler).Methods("PUT")
+// Server handles requests to the words service. Word lists are kept in
+// Store. Context returns the context for a request and Logger records what
+// the server is doing. Changed, if set, is called with the id of each word
+// list that is written or deleted.
+type Server struct {
+	Store   WordListStore
+	Context func(*http.Request) context.Context
+	Logger  logging.Logger
+	Changed func(ctx context.Context, id string)
+}
 
-	http.Handle("/", r)
+// NewServer returns a Server that keeps word lists in store, using the
+// request context and the standard library logger.
+func NewServer(store WordListStore) *Server {
+	return &Server{
+		Store:   store,
+		Context: (*http.Request).Context,
+		Logger:  logging.Std,
+	}
 }
 
-func PostWordsHandler(w http.ResponseWriter, r *http.Request) {
+// Router returns a handler that routes requests to the words service.
+func (s *Server) Router() http.Handler {
+	r := mux.NewRouter()
+	r.HandleFunc("/words", s.PostWordsHandler).Methods("POST")
+	r.HandleFunc("/words/{id}", s.GetWordsHandler).Methods("GET")
+	r.HandleFunc("/words/{id}", s.DeleteWordsHandler).Methods("DELETE")
+	r.HandleFunc("/words/{id}", s.PutWordsHandler).Methods("PUT")
+	return r
+}
 
-	// We get the context for the incoming HTTP request
-	// https://cloud.google.com/appengine/docs/standard/go/reference#NewContext
-	ctx := appengine.NewContext(r)
+func (s *Server) PostWordsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := s.Context(r)
 
 	// Get the token value from the uploaded data
 	token := r.FormValue("token")
@@ -48,126 +66,79 @@ func PostWordsHandler(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("bad request: %v:", err))
 		return
 	}
+	defer f.Close()
 
-	// TODO: blog post this
-	// Write the file to Google Cloud Storage
-	client, err := storage.NewClient(ctx)
+	// Convert flashcard exports into a word list before storing them
+	words, err := importWords(r.FormValue("format"), f)
 	if err != nil {
-		log.Errorf(ctx, "failed to get client: %v", err)
-	}
-
-	bucketName, err := file.DefaultBucketName(ctx)
-	if err != nil {
-		log.Errorf(ctx, "failed to get default GCS bucket name: %v", err)
-		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("storage service failure: %v:", err))
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("unable to import words: %v", err))
 		return
 	}
-	bucket := client.Bucket(bucketName)
 
-	log.Infof(ctx, "Received file %s for token %s", fh.Filename, token)
-	log.Infof(ctx, "Creating file /%v/%v\n", bucketName, token)
+	s.Logger.Infof(ctx, "Received file %s for token %s", fh.Filename, token)
 
-	obj := bucket.Object(token)
-	objw := obj.NewWriter(ctx)
-
-	if _, err := io.Copy(objw, f); err != nil {
-		log.Errorf(ctx, "failed to copy file: %v", err.Error())
-		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("storage service failure: %v:", err))
-		return
-	}
-	if err := objw.Close(); err != nil {
-		log.Errorf(ctx, "failed to close storage object: %v", err.Error())
-		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("storage service failure: %v:", err))
+	if err := s.Store.Put(ctx, token, words); err != nil {
+		s.storeError(ctx, w, token, err)
 		return
 	}
-
-	f.Close()
+	s.changed(ctx, token)
 
 	respondWithJSON(w, http.StatusCreated, nil)
 }
 
-func GetWordsHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := appengine.NewContext(r)
-
-	vars := mux.Vars(r)
-	id := vars["id"]
+// ImportWords returns a reader over the known word list held in an upload.
+// Plain word lists are returned as they are, while flashcard exports in
+// one of the flashcards.Formats are converted to a word list.
+func importWords(format string, f io.Reader) (io.Reader, error) {
+	if format == "" || format == "text" {
+		return f, nil
+	}
 
-	client, err := storage.NewClient(ctx)
+	cards, err := flashcards.Import(format, f)
 	if err != nil {
-		log.Errorf(ctx, "failed to get client: %v", err)
+		return nil, err
 	}
 
-	bucketName, err := file.DefaultBucketName(ctx)
-	if err != nil {
-		log.Errorf(ctx, "failed to get default GCS bucket name: %v", err)
-		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("storage service failure: %v:", err))
-		return
+	var b bytes.Buffer
+	if err := flashcards.WriteWordList(&b, cards); err != nil {
+		return nil, err
 	}
-	bucket := client.Bucket(bucketName)
+	return &b, nil
+}
+
+func (s *Server) GetWordsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := s.Context(r)
+
+	vars := mux.Vars(r)
+	id := vars["id"]
 
-	obj := bucket.Object(id)
-	objr, err := obj.NewReader(ctx)
+	objr, err := s.Store.Get(ctx, id)
 	if err != nil {
-		log.Errorf(ctx, "unable to read object: %v", err)
-		respondWithError(w, http.StatusNotFound, fmt.Sprintf("record not found: %s:", id))
+		s.storeError(ctx, w, id, err)
 		return
 	}
+	defer objr.Close()
 
 	io.Copy(w, objr)
-	objr.Close()
 }
 
-func DeleteWordsHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := appengine.NewContext(r)
+func (s *Server) DeleteWordsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := s.Context(r)
 
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	client, err := storage.NewClient(ctx)
-	if err != nil {
-		log.Errorf(ctx, "failed to get client: %v", err)
-	}
-
-	bucketName, err := file.DefaultBucketName(ctx)
-	if err != nil {
-		log.Errorf(ctx, "failed to get default GCS bucket name: %v", err)
-		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("storage service failure: %v:", err))
-		return
-	}
-	bucket := client.Bucket(bucketName)
-
-	obj := bucket.Object(id)
-	err = obj.Delete(ctx)
-	if err != nil {
-		log.Errorf(ctx, "failed to delete object: %v", err)
-		respondWithError(w, http.StatusNotFound, fmt.Sprintf("record not found: %s:", id))
+	if err := s.Store.Delete(ctx, id); err != nil {
+		s.storeError(ctx, w, id, err)
 		return
 	}
+	s.changed(ctx, id)
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// RespondWithError is a helper function that sets the HTTP status code and returns
-// a JSON formatted error payload.
-func respondWithError(w http.ResponseWriter, code int, message string) {
-	respondWithJSON(w, code, map[string]string{"error": message})
-}
-
-// RespondWithJSON is a helper function that sets the HTTP status code and marshals
-// a struct into a JSON payload.
-func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
-	response, _ := json.Marshal(payload)
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	w.Write(response)
-}
-
-func PutWordsHandler(w http.ResponseWriter, r *http.Request) {
-
-	// TODO: check that the file exists before accepting files of an arbitrary name
-
-	ctx := appengine.NewContext(r)
+func (s *Server) PutWordsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := s.Context(r)
 
 	vars := mux.Vars(r)
 	id := vars["id"]
@@ -181,44 +152,67 @@ func PutWordsHandler(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("bad request: %v:", err))
 		return
 	}
+	defer f.Close()
 
-	client, err := storage.NewClient(ctx)
+	words, err := importWords(r.FormValue("format"), f)
 	if err != nil {
-		log.Errorf(ctx, "failed to get client: %v", err)
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("unable to import words: %v", err))
+		return
 	}
 
-	bucketName, err := file.DefaultBucketName(ctx)
+	// check that the word list exists
+	ok, err := s.Store.Exists(ctx, id)
 	if err != nil {
-		log.Errorf(ctx, "failed to get default GCS bucket name: %v", err)
-		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("storage service failure: %v:", err))
+		s.storeError(ctx, w, id, err)
 		return
 	}
-	bucket := client.Bucket(bucketName)
-
-	obj := bucket.Object(id)
-
-	// check that the object exists
-	_, err = obj.Attrs(ctx)
-	if err != nil {
-		log.Errorf(ctx, "failed to get file attributes: %v", err)
+	if !ok {
 		respondWithError(w, http.StatusNotFound, fmt.Sprintf("record not found: %s:", id))
 		return
 	}
 
-	objw := obj.NewWriter(ctx)
-
-	if _, err := io.Copy(objw, f); err != nil {
-		log.Errorf(ctx, "failed to copy file: %v", err.Error())
-		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("storage service failure: %v:", err))
+	if err := s.Store.Put(ctx, id, words); err != nil {
+		s.storeError(ctx, w, id, err)
 		return
 	}
-	if err := objw.Close(); err != nil {
-		log.Errorf(ctx, "failed to close storage object: %v", err.Error())
+	s.changed(ctx, id)
+
+	respondWithJSON(w, http.StatusCreated, nil)
+}
+
+// Changed reports a written or deleted word list to the Changed hook.
+func (s *Server) changed(ctx context.Context, id string) {
+	if s.Changed != nil {
+		s.Changed(ctx, id)
+	}
+}
+
+// StoreError responds to a failure of the word list store. Missing and
+// invalid ids are reported to the client and anything else is logged.
+func (s *Server) storeError(ctx context.Context, w http.ResponseWriter, id string, err error) {
+	switch err {
+	case ErrNotFound:
+		respondWithError(w, http.StatusNotFound, fmt.Sprintf("record not found: %s:", id))
+	case ErrInvalidID:
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid id: %s:", id))
+	default:
+		s.Logger.Errorf(ctx, "storage failure for %s: %v", id, err)
 		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("storage service failure: %v:", err))
-		return
 	}
+}
 
-	f.Close()
+// RespondWithError is a helper function that sets the HTTP status code and returns
+// a JSON formatted error payload.
+func respondWithError(w http.ResponseWriter, code int, message string) {
+	respondWithJSON(w, code, map[string]string{"error": message})
+}
 
-	respondWithJSON(w, http.StatusCreated, nil)
+// RespondWithJSON is a helper function that sets the HTTP status code and marshals
+// a struct into a JSON payload.
+func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
+	response, _ := json.Marshal(payload)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(response)
 }
@@ -0,0 +1,208 @@
+package words
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/billglover/chinese-reader/internal/logging"
+	"github.com/billglover/chinese-reader/internal/servicetest"
+)
+
+// uploadRequest returns a multipart request holding a word list, as sent
+// by the upload form. Empty fields are left out of the form.
+func uploadRequest(t *testing.T, method, url string, fields map[string]string, words string) *http.Request {
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+	for k, v := range fields {
+		if v != "" {
+			mw.WriteField(k, v)
+		}
+	}
+	if words != "" {
+		fw, err := mw.CreateFormFile("words", "words.txt")
+		if err != nil {
+			t.Fatalf("unexpected error returned: %s", err)
+		}
+		io.WriteString(fw, words)
+	}
+	mw.Close()
+
+	r := httptest.NewRequest(method, url, &b)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func newTestServer(t *testing.T) (*Server, *MemoryStore) {
+	store := NewMemoryStore()
+	s := NewServer(store)
+	s.Logger = logging.Func(t.Logf)
+	return s, store
+}
+
+func stored(t *testing.T, store WordListStore, id string) string {
+	rc, err := store.Get(context.Background(), id)
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+	defer rc.Close()
+	b, _ := ioutil.ReadAll(rc)
+	return string(b)
+}
+
+func TestPostWordsHandler(t *testing.T) {
+	skritter := "Word,Reading,Definition\n学习,xuéxí,to study\n"
+
+	tests := []struct {
+		name   string
+		fields map[string]string
+		words  string
+		code   int
+		want   string
+	}{
+		{"no token", map[string]string{}, "学习\n", http.StatusBadRequest, ""},
+		{"no file", map[string]string{"token": "abc"}, "", http.StatusBadRequest, ""},
+		{"word list", map[string]string{"token": "abc"}, "学习\n老师\n", http.StatusCreated, "学习\n老师\n"},
+		{"flashcards", map[string]string{"token": "abc", "format": "skritter"}, skritter, http.StatusCreated, "学习\txuéxí\tto study\n"},
+		{"unknown format", map[string]string{"token": "abc", "format": "mnemosyne"}, "学习\n", http.StatusBadRequest, ""},
+	}
+
+	for _, tc := range tests {
+		s, store := newTestServer(t)
+		rw := servicetest.Serve(s.Router(), uploadRequest(t, "POST", "/words", tc.fields, tc.words))
+
+		if rw.Code != tc.code {
+			t.Errorf("%s: unexpected status: want %d, got %d", tc.name, tc.code, rw.Code)
+			continue
+		}
+		if rw.Code != http.StatusCreated {
+			var e map[string]string
+			if err := json.Unmarshal(rw.Body.Bytes(), &e); err != nil || e["error"] == "" {
+				t.Errorf("%s: unexpected error body: %q", tc.name, rw.Body.String())
+			}
+			continue
+		}
+		if got := stored(t, store, "abc"); got != tc.want {
+			t.Errorf("%s: unexpected word list: want %q, got %q", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestGetWordsHandler(t *testing.T) {
+	s, store := newTestServer(t)
+	store.Put(context.Background(), "abc", strings.NewReader("学习\n"))
+
+	rw := servicetest.Serve(s.Router(), httptest.NewRequest("GET", "/words/abc", nil))
+	if rw.Code != http.StatusOK || rw.Body.String() != "学习\n" {
+		t.Errorf("unexpected response: want %d %q, got %d %q", http.StatusOK, "学习\n", rw.Code, rw.Body.String())
+	}
+
+	rw = servicetest.Serve(s.Router(), httptest.NewRequest("GET", "/words/xyz", nil))
+	if rw.Code != http.StatusNotFound {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusNotFound, rw.Code)
+	}
+}
+
+func TestPutWordsHandler(t *testing.T) {
+	s, store := newTestServer(t)
+	store.Put(context.Background(), "abc", strings.NewReader("学习\n"))
+
+	rw := servicetest.Serve(s.Router(), uploadRequest(t, "PUT", "/words/xyz", nil, "老师\n"))
+	if rw.Code != http.StatusNotFound {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusNotFound, rw.Code)
+	}
+	if ok, _ := store.Exists(context.Background(), "xyz"); ok {
+		t.Errorf("unexpected word list created by PUT")
+	}
+
+	rw = servicetest.Serve(s.Router(), uploadRequest(t, "PUT", "/words/abc", nil, ""))
+	if rw.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusBadRequest, rw.Code)
+	}
+
+	rw = servicetest.Serve(s.Router(), uploadRequest(t, "PUT", "/words/abc", nil, "老师\n"))
+	if rw.Code != http.StatusCreated {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusCreated, rw.Code)
+	}
+	if got := stored(t, store, "abc"); got != "老师\n" {
+		t.Errorf("unexpected word list: want %q, got %q", "老师\n", got)
+	}
+}
+
+func TestDeleteWordsHandler(t *testing.T) {
+	s, store := newTestServer(t)
+	store.Put(context.Background(), "abc", strings.NewReader("学习\n"))
+
+	rw := servicetest.Serve(s.Router(), httptest.NewRequest("DELETE", "/words/abc", nil))
+	if rw.Code != http.StatusNoContent {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusNoContent, rw.Code)
+	}
+	if ok, _ := store.Exists(context.Background(), "abc"); ok {
+		t.Errorf("word list not deleted")
+	}
+
+	rw = servicetest.Serve(s.Router(), httptest.NewRequest("DELETE", "/words/abc", nil))
+	if rw.Code != http.StatusNotFound {
+		t.Errorf("unexpected status: want %d, got %d", http.StatusNotFound, rw.Code)
+	}
+}
+
+func TestStores(t *testing.T) {
+	fs, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error returned: %s", err)
+	}
+
+	stores := map[string]WordListStore{
+		"memory": NewMemoryStore(),
+		"file":   fs,
+	}
+
+	ctx := context.Background()
+	for name, store := range stores {
+		if _, err := store.Get(ctx, "abc"); err != ErrNotFound {
+			t.Errorf("%s: unexpected error: want %v, got %v", name, ErrNotFound, err)
+		}
+		if err := store.Delete(ctx, "abc"); err != ErrNotFound {
+			t.Errorf("%s: unexpected error: want %v, got %v", name, ErrNotFound, err)
+		}
+
+		for _, id := range []string{"abc", "def", "abc"} {
+			if err := store.Put(ctx, id, strings.NewReader("学习 "+id)); err != nil {
+				t.Fatalf("%s: unexpected error returned: %s", name, err)
+			}
+		}
+		if got := stored(t, store, "abc"); got != "学习 abc" {
+			t.Errorf("%s: unexpected word list: want %q, got %q", name, "学习 abc", got)
+		}
+
+		ids, err := store.List(ctx)
+		if want := []string{"abc", "def"}; err != nil || !reflect.DeepEqual(ids, want) {
+			t.Errorf("%s: unexpected ids: want %v, got %v (%v)", name, want, ids, err)
+		}
+
+		if err := store.Delete(ctx, "def"); err != nil {
+			t.Errorf("%s: unexpected error returned: %s", name, err)
+		}
+		if ok, err := store.Exists(ctx, "def"); ok || err != nil {
+			t.Errorf("%s: unexpected existence: want %v, got %v (%v)", name, false, ok, err)
+		}
+		if ok, err := store.Exists(ctx, "abc"); !ok || err != nil {
+			t.Errorf("%s: unexpected existence: want %v, got %v (%v)", name, true, ok, err)
+		}
+	}
+
+	for _, id := range []string{"", "..", "../abc", "a/b", ".tmp-1"} {
+		if err := fs.Put(ctx, id, strings.NewReader("学习")); err != ErrInvalidID {
+			t.Errorf("%q: unexpected error: want %v, got %v", id, ErrInvalidID, err)
+		}
+	}
+}